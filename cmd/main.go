@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,6 +17,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rtreffer/kubernetes-pressurecooker/pkg/config"
 	"github.com/rtreffer/kubernetes-pressurecooker/pkg/pressurecooker"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -24,7 +28,7 @@ var (
 	pressureThresholdExceeded = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: prometheusNamespace,
 		Name:      "pressure_threshold_exceeded",
-		Help:      "cpu pressure is currently above (1) or below (0) threshold",
+		Help:      "pressure is currently above (1) or below (0) threshold",
 	})
 	pressureThresholdExceededTotal = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: prometheusNamespace,
@@ -36,28 +40,58 @@ var (
 		Name:      "pressure_recovered_total",
 		Help:      "number of times the pressure on the node recovered",
 	})
-	pressureEnabled = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: prometheusNamespace,
-		Name:      "enabled",
-		Help:      "pressurecooker is enabled (1) or disabled (0)",
-	})
 )
 
 func main() {
 	prometheus.MustRegister(pressureThresholdExceeded)
 	prometheus.MustRegister(pressureThresholdExceededTotal)
 	prometheus.MustRegister(pressureRecoveredTotal)
-	prometheus.MustRegister(pressureEnabled)
 
 	var f config.StartupFlags
 
 	flag.StringVar(&f.KubeConfig, "kubeconfig", "", "file path to kubeconfig")
 	flag.Float64Var(&f.TaintThreshold, "taint-threshold", 25, "pressure threshold value")
+	flag.Float64Var(&f.UntaintThreshold, "untaint-threshold", 0, "pressure value to fall below before the taint is removed (defaults to taint-threshold)")
 	flag.Float64Var(&f.EvictThreshold, "evict-threshold", 50, "pressure threshold value")
 	flag.StringVar(&f.EvictBackoff, "evict-backoff", "10m", "time to wait between evicting Pods")
-	flag.StringVar(&f.MinPodAge, "min-pod-age", "5m", "minimum age of Pods to be evicted")
+	flag.IntVar(&f.MaxEvictions, "max-evictions", 0, "maximum number of Pods evicted within -max-evictions-window (0 disables the cap)")
+	flag.StringVar(&f.MaxEvictionsWindow, "max-evictions-window", "10m", "rolling time window for -max-evictions")
+	flag.IntVar(&f.BatchMax, "batch-max", 1, "maximum number of Pods evicted at once when the pressure is far above the eviction threshold")
+	flag.Float64Var(&f.BatchStep, "batch-step", 10, "evict one more Pod at once for every this many percentage points the pressure is above the eviction threshold, up to -batch-max")
+	flag.StringVar(&f.CordonAfter, "cordon-after", "0s", "cordon the node once no Pod could be evicted for this long while the pressure stays above the eviction threshold (0s disables)")
+	flag.StringVar(&f.EvictionSummary, "eviction-summary-interval", "1h", "interval of the EvictionSummary event listing the Pods evicted from the node (0s disables)")
+	flag.StringVar(&f.MinPodAge, "min-pod-age", "", "minimum age of Pods to be evicted, empty uses the age of the scoring profile (10m, conservative 30m, aggressive 2m)")
+	flag.StringVar(&f.GracePeriod, "grace-period", "", "termination grace period of evicted Pods, e.g. 10s (defaults to the Pod's own, 0s evicts immediately)")
+	flag.BoolVar(&f.DryRun, "dry-run", false, "only log the Pods that would be evicted")
+	flag.IntVar(&f.MinScore, "min-score", 0, "minimum eviction score of a Pod to be evicted")
+	flag.StringVar(&f.ScoringProfile, "scoring-profile", "default", "preset of scoring weights (default, conservative, aggressive or batch-friendly)")
+	flag.IntVar(&f.RecentPodWeight, "recent-pod-weight", 0, "eviction score added to Pods that just passed -min-pod-age, decaying until they are twice as old; usually negative (0 disables)")
+	flag.StringVar(&f.RecentPodDecay, "recent-pod-decay", "linear", "how the score of -recent-pod-weight decays (linear, cosine or step)")
+	flag.IntVar(&f.RequestWeight, "request-weight", 0, "eviction score added to the Pod with the biggest request of the resource under pressure, other Pods get a share by their request (0 disables)")
+	flag.BoolVar(&f.ReplicaAware, "replica-aware", false, "avoid evicting the last ready replicas of ReplicaSets and StatefulSets")
+	flag.StringVar(&f.Namespaces, "namespaces", "", "comma separated list of namespaces to evict Pods from (defaults to all)")
+	flag.StringVar(&f.ExcludedNamespaces, "exclude-namespaces", "", "comma separated list of namespaces to never evict Pods from")
+	flag.StringVar(&f.PodSelector, "pod-selector", "", "label selector restricting the Pods to evict, e.g. tier=batch")
 	flag.StringVar(&f.NodeName, "node-name", "", "current node name")
 	flag.IntVar(&f.MetricsPort, "metrics-port", 8080, "port for prometheus metrics endpoint")
+	flag.StringVar(&f.ProcPath, "proc-path", "/proc", "mount point of the host's procfs")
+	flag.StringVar(&f.Resources, "resources", "", "comma separated list of resources to watch (cpu, memory, io), defaults to cpu, or to memory when falling back to -memory-pressure-level")
+	flag.StringVar(&f.ResourceThresholds, "resource-thresholds", "", "comma separated resource=threshold list overriding the taint threshold per resource, e.g. io=10")
+	flag.StringVar(&f.Window, "window", "300", "pressure average in seconds compared against the taint threshold (10, 60 or 300)")
+	flag.StringVar(&f.StallType, "stall-type", "some", "pressure line compared against the thresholds (some or full)")
+	flag.IntVar(&f.ReadRetries, "read-retries", 2, "number of retries of a failed or empty pressure read before it is reported as an error")
+	flag.BoolVar(&f.KubeletSummary, "kubelet-summary", false, "read the cpu and memory usage in percent of the node's allocatable from the kubelet summary API instead of /proc/pressure")
+	flag.BoolVar(&f.PressureLevel, "memory-pressure-level", false, "fall back to the cgroup v1 memory.pressure_level notifications on kernels without /proc/pressure (memory only)")
+	flag.StringVar(&f.Aggregation, "aggregate", "", "combine the watched resources: taint when any or only when all of them are high (any or all, defaults to tracking each resource on its own)")
+	flag.StringVar(&f.SustainedFor, "sustained-for", "0s", "time the pressure has to stay above the taint threshold before the node is tainted")
+	flag.StringVar(&f.StuckAfter, "stuck-after", "0s", "warn once the pressure stayed above the taint threshold for this long despite evictions (0s disables)")
+	flag.StringVar(&f.Warmup, "warmup", "0s", "time after startup during which the pressure is only logged, e.g. to ignore the node's boot spike")
+	flag.Float64Var(&f.Jitter, "jitter", 0, "randomize the interval between two pressure reads by up to this fraction, e.g. 0.1 for 10% (0 disables)")
+	flag.Float64Var(&f.BaselineDeviations, "baseline-deviations", 0, "learn the usual pressure of the node and taint once it is this many standard deviations above it instead of using the absolute thresholds (0 disables)")
+	flag.IntVar(&f.BaselineSamples, "baseline-samples", 0, "number of pressure reads the baseline of -baseline-deviations is learnt from (0 for the default of 240)")
+	flag.Float64Var(&f.Smoothing, "smoothing", 0, "compare an exponential moving average of the pressure across ticks against the thresholds; between 0 and 1, lower values smooth more (0 disables)")
+	flag.Float64Var(&f.RiseRate, "rise-rate", 0, "log an early warning when the pressure below the taint threshold rises by this many percentage points per minute (0 disables)")
+	flag.StringVar(&f.Cgroups, "cgroups", "", "comma separated list of name=path cgroups to watch in addition, e.g. pods=kubepods.slice")
 	flag.Parse()
 
 	if f.NodeName == "" {
@@ -74,7 +108,81 @@ func main() {
 		panic(err)
 	}
 
-	w, err := pressurecooker.NewWatcher(f.TaintThreshold)
+	resources, err := pressurecooker.ParseResources(f.Resources)
+	if err != nil {
+		panic(err)
+	}
+
+	thresholds, err := pressurecooker.ParseThresholds(f.ResourceThresholds)
+	if err != nil {
+		panic(err)
+	}
+
+	window, err := pressurecooker.ParseWindow(f.Window)
+	if err != nil {
+		panic(err)
+	}
+
+	stallType, err := pressurecooker.ParseStallType(f.StallType)
+	if err != nil {
+		panic(err)
+	}
+
+	var aggregation pressurecooker.Aggregation
+	if f.Aggregation != "" {
+		if aggregation, err = pressurecooker.ParseAggregation(f.Aggregation); err != nil {
+			panic(err)
+		}
+	}
+
+	sustainedFor, err := time.ParseDuration(f.SustainedFor)
+	if err != nil {
+		panic(err)
+	}
+
+	warmup, err := time.ParseDuration(f.Warmup)
+	if err != nil {
+		panic(err)
+	}
+
+	stuckAfter, err := time.ParseDuration(f.StuckAfter)
+	if err != nil {
+		panic(err)
+	}
+
+	cgroups, err := pressurecooker.ParseCgroups(f.Cgroups)
+	if err != nil {
+		panic(err)
+	}
+
+	var reader pressurecooker.PSIReader
+	if f.KubeletSummary {
+		reader = pressurecooker.NewSummaryReader(c, f.NodeName)
+	}
+
+	w, err := pressurecooker.NewWatcherFromConfig(pressurecooker.WatcherConfig{
+		ProcPath:            f.ProcPath,
+		PSIReader:           reader,
+		ReadRetries:         f.ReadRetries,
+		Resources:           resources,
+		PressureThreshold:   f.TaintThreshold,
+		LowThreshold:        f.UntaintThreshold,
+		Thresholds:          thresholds,
+		Window:              window,
+		StallType:           stallType,
+		Aggregation:         aggregation,
+		MemoryPressureLevel: f.PressureLevel,
+		SustainedFor:        sustainedFor,
+		Cgroups:             cgroups,
+		RiseRate:            f.RiseRate,
+		Smoothing:           f.Smoothing,
+		Jitter:              f.Jitter,
+		BaselineDeviations:  f.BaselineDeviations,
+		BaselineSamples:     f.BaselineSamples,
+		Warmup:              warmup,
+		StuckAfter:          stuckAfter,
+		Node:                pressurecooker.NewNodeAccessor(c, f.NodeName),
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -88,8 +196,53 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	e.DryRun = f.DryRun
+	e.ReplicaAware = f.ReplicaAware
+	if e.CordonAfter, err = time.ParseDuration(f.CordonAfter); err != nil {
+		panic(err)
+	}
+	e.Cordoner = t
+	e.RequestWeight = f.RequestWeight
+	e.RecentPodWeight = f.RecentPodWeight
+	if e.RecentPodDecay, err = pressurecooker.ParseAgeDecay(f.RecentPodDecay); err != nil {
+		panic(err)
+	}
+	e.MaxEvictions = f.MaxEvictions
+	if f.BatchMax > 1 {
+		e.BatchPolicy = pressurecooker.StepBatchPolicy(f.BatchStep, f.BatchMax)
+	}
+	if e.EvictionWindow, err = time.ParseDuration(f.MaxEvictionsWindow); err != nil {
+		panic(err)
+	}
+	if f.GracePeriod != "" {
+		gracePeriod, err := time.ParseDuration(f.GracePeriod)
+		if err != nil {
+			panic(err)
+		}
+		seconds := int64(gracePeriod / time.Second)
+		e.GracePeriod = &seconds
+	}
+	if f.PodSelector != "" {
+		if e.PodSelector, err = labels.Parse(f.PodSelector); err != nil {
+			panic(err)
+		}
+	}
+	profile, err := pressurecooker.ParseScoringProfile(f.ScoringProfile)
+	if err != nil {
+		panic(err)
+	}
+	e.Scoring = profile.Config()
+	e.Scoring.Namespaces = splitList(f.Namespaces)
+	e.Scoring.ExcludedNamespaces = splitList(f.ExcludedNamespaces)
+	if f.MinScore > 0 {
+		e.Scoring.MinScore = f.MinScore
+	}
+	if err := e.Scoring.Validate(); err != nil {
+		panic(err)
+	}
 
-	closeChan := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
@@ -99,7 +252,14 @@ func main() {
 
 		glog.Infof("received signal %s", s)
 
-		close(closeChan)
+		// let the current tick finish, the loop closes its channels once done
+		shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 10*time.Second)
+		if err := w.Shutdown(shutdownCtx); err != nil {
+			glog.Errorf("watcher did not stop in time: %s", err.Error())
+		}
+		shutdownCancel()
+
+		cancel()
 	}()
 
 	go func() {
@@ -107,6 +267,15 @@ func main() {
 			w.Header().Set("Content-Type", "text/plain")
 			w.Write([]byte("OK\n"))
 		})
+		http.HandleFunc("/-/pressure", func(rw http.ResponseWriter, r *http.Request) {
+			events, err := w.Current(r.Context())
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(rw).Encode(events)
+		})
 		http.Handle("/metrics", promhttp.Handler())
 		http.ListenAndServe(fmt.Sprintf("0.0.0.0:%d", f.MetricsPort), nil)
 	}()
@@ -116,59 +285,63 @@ func main() {
 		panic(err)
 	}
 
-	isDisabled, err := t.IsPressurecookerDisabled()
-	lastDisabledCheck := time.Now()
-	if err != nil {
-		panic(err)
-	}
-	if isDisabled {
-		pressureEnabled.Set(0)
-	} else {
-		pressureEnabled.Set(1)
-	}
+	// the node stays tainted as long as any of the watched resources is high
+	highResources := make(map[pressurecooker.Resource]bool)
 
 	w.SetAsHigh(isTainted)
 	if isTainted {
+		for _, r := range w.Resources {
+			highResources[r] = true
+		}
 		pressureThresholdExceeded.Set(1)
 	} else {
 		pressureThresholdExceeded.Set(0)
 	}
 
-	exc, dec, errs := w.Run(closeChan)
+	summaryInterval, err := time.ParseDuration(f.EvictionSummary)
+	if err != nil {
+		panic(err)
+	}
+	var summary <-chan time.Time
+	if summaryInterval > 0 {
+		summaryTicker := time.NewTicker(summaryInterval)
+		defer summaryTicker.Stop()
+		summary = summaryTicker.C
+	}
+
+	exc, dec, errs := w.Run(ctx)
 	for {
 		select {
+		case <-summary:
+			e.RecordEvictionSummary(summaryInterval)
 		case evt, ok := <-exc:
 			if !ok {
 				glog.Infof("exceedance channel closed; stopping")
 				return
 			}
 
-			if time.Now().Sub(lastDisabledCheck) > 1*time.Minute {
-				if disabled, err := t.IsPressurecookerDisabled(); err == nil {
-					isDisabled = disabled
-					if isDisabled {
-						pressureEnabled.Set(0)
-					} else {
-						pressureEnabled.Set(1)
-					}
-				} else {
-					glog.Errorf("could not check pressurecooker.enabled: %s", err.Error())
-				}
-				lastDisabledCheck = time.Now()
+			if evt.State == pressurecooker.PressureStuck {
+				glog.Warningf("%s pressure of %s stays above threshold despite evictions, avg300=%f avg60=%f avg10=%f", evt.Resource, f.NodeName, evt.Avg300, evt.Avg60, evt.Avg10)
 			}
-			if isDisabled && isTainted {
-				if err := t.UntaintNode(pressurecooker.PressureThresholdEvent{}); err != nil {
-					glog.Errorf("error while untainting node: %s", err.Error())
-				} else {
-					isTainted = false
-				}
+
+			if evt.State == pressurecooker.PressureRising {
+				glog.Warningf("%s pressure rising by %.2f/min, avg300=%f avg60=%f avg10=%f", evt.Resource, evt.Rate, evt.Avg300, evt.Avg60, evt.Avg10)
+				continue
 			}
 
-			if isDisabled {
-				glog.Infof("pressurecooker disabled, pressure: %v", evt)
+			// cgroup pressure is only reported, the node is tainted based on
+			// the node-wide pressure
+			if evt.CgroupName != "" {
+				if evt.State == pressurecooker.PressureExceeded {
+					glog.Infof("%s pressure of cgroup %s exceeded threshold, avg300=%f avg60=%f avg10=%f", evt.Resource, evt.CgroupName, evt.Avg300, evt.Avg60, evt.Avg10)
+				}
 				continue
 			}
 
+			highResources[evt.Resource] = true
+
+			// the watcher reports nothing but recoveries while the node is
+			// disabled
 			if isTainted {
 				if _, err := e.EvictPod(evt); err != nil {
 					glog.Errorf("error while evicting pod: %s", err.Error())
@@ -176,7 +349,7 @@ func main() {
 				continue
 			}
 
-			glog.Infof("5 minute pressure average exceeded threshold, avg300=%f", evt.Avg300)
+			glog.Infof("%s pressure exceeded threshold, %.2f above %.2f, avg300=%f avg60=%f avg10=%f", evt.Resource, evt.Excess(), evt.Threshold, evt.Avg300, evt.Avg60, evt.Avg10)
 
 			if err := t.TaintNode(evt); err != nil {
 				glog.Errorf("error while tainting node: %s", err.Error())
@@ -191,11 +364,49 @@ func main() {
 				return
 			}
 
-			if !isTainted {
+			if evt.CgroupName != "" {
+				if evt.State == pressurecooker.PressureRecovered {
+					glog.Infof("%s pressure of cgroup %s recovered, avg300=%f avg60=%f avg10=%f", evt.Resource, evt.CgroupName, evt.Avg300, evt.Avg60, evt.Avg10)
+				}
+				continue
+			}
+
+			// the node got disabled, the watcher released all resources
+			if evt.State == pressurecooker.PressurePaused {
+				highResources = make(map[pressurecooker.Resource]bool)
+				if !isTainted {
+					continue
+				}
+				glog.Infof("pressurecooker disabled on node %s, removing taint", f.NodeName)
+				if err := t.UntaintNode(evt); err != nil {
+					glog.Errorf("error while removing taint from node: %s", err.Error())
+				} else {
+					isTainted = false
+					pressureThresholdExceeded.Set(0)
+				}
+				if e.Recovered() {
+					if err := t.UncordonNode(); err != nil {
+						glog.Errorf("error while uncordoning node: %s", err.Error())
+					}
+				}
 				continue
 			}
 
-			glog.Infof("pressure deceeded threshold, avg300=%f avg60=%f avg10=%f", evt.Avg300, evt.Avg60, evt.Avg10)
+			if evt.State == pressurecooker.PressureRecovered {
+				glog.Infof("%s pressure recovered, avg300=%f avg60=%f avg10=%f", evt.Resource, evt.Avg300, evt.Avg60, evt.Avg10)
+			}
+
+			if w.Aggregation != "" {
+				// combined events represent all resources
+				highResources = make(map[pressurecooker.Resource]bool)
+			} else {
+				delete(highResources, evt.Resource)
+			}
+			if !isTainted || len(highResources) > 0 {
+				continue
+			}
+
+			glog.Infof("%s pressure deceeded threshold, avg300=%f avg60=%f avg10=%f", evt.Resource, evt.Avg300, evt.Avg60, evt.Avg10)
 			if err := t.UntaintNode(evt); err != nil {
 				glog.Errorf("error while removing taint from node: %s", err.Error())
 			} else {
@@ -203,13 +414,33 @@ func main() {
 				pressureThresholdExceeded.Set(0)
 				pressureRecoveredTotal.Inc()
 			}
+			if e.Recovered() {
+				if err := t.UncordonNode(); err != nil {
+					glog.Errorf("error while uncordoning node: %s", err.Error())
+				}
+			}
+
+		case err, ok := <-errs:
+			if !ok {
+				glog.Infof("error channel closed; stopping")
+				return
+			}
 
-		case err := <-errs:
 			glog.Errorf("error while polling for status updates: %s", err.Error())
 		}
 	}
 }
 
+func splitList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func loadKubernetesConfig(f config.StartupFlags) (*rest.Config, error) {
 	if f.KubeConfig == "" {
 		return rest.InClusterConfig()
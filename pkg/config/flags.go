@@ -1,11 +1,47 @@
 package config
 
 type StartupFlags struct {
-	KubeConfig     string
-	TaintThreshold float64
-	EvictThreshold float64
-	EvictBackoff   string
-	MinPodAge      string
-	NodeName       string
-	MetricsPort    int
+	KubeConfig         string
+	TaintThreshold     float64
+	UntaintThreshold   float64
+	EvictThreshold     float64
+	EvictBackoff       string
+	MaxEvictions       int
+	MaxEvictionsWindow string
+	BatchMax           int
+	BatchStep          float64
+	EvictionSummary    string
+	CordonAfter        string
+	MinPodAge          string
+	GracePeriod        string
+	DryRun             bool
+	ReplicaAware       bool
+	RequestWeight      int
+	RecentPodWeight    int
+	RecentPodDecay     string
+	MinScore           int
+	ScoringProfile     string
+	Namespaces         string
+	ExcludedNamespaces string
+	PodSelector        string
+	NodeName           string
+	MetricsPort        int
+	ProcPath           string
+	ReadRetries        int
+	Resources          string
+	ResourceThresholds string
+	Window             string
+	StallType          string
+	Aggregation        string
+	PressureLevel      bool
+	KubeletSummary     bool
+	SustainedFor       string
+	RiseRate           float64
+	Smoothing          float64
+	Jitter             float64
+	BaselineDeviations float64
+	BaselineSamples    int
+	Warmup             string
+	StuckAfter         string
+	Cgroups            string
 }
@@ -0,0 +1,106 @@
+package pressurecooker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ErrEvictionBlocked is returned by Evict if the API server refused the
+// eviction with 429 Too Many Requests, usually because it would violate a
+// PodDisruptionBudget. The eviction can be retried later.
+var ErrEvictionBlocked = errors.New("eviction blocked")
+
+const (
+	evictionV1      = "policy/v1"
+	evictionV1beta1 = "policy/v1beta1"
+)
+
+// Evict evicts pod through the eviction API, honouring PodDisruptionBudgets.
+// It posts a policy/v1 Eviction if the cluster serves that version and
+// falls back to policy/v1beta1 otherwise. gracePeriod is in seconds, see
+// evictionGracePeriod. A pod that is already gone is not an error.
+func Evict(ctx context.Context, client kubernetes.Interface, pod *v1.Pod, gracePeriod *int64) error {
+	version := evictionVersion(client)
+	gracePeriod = evictionGracePeriod(pod, gracePeriod)
+
+	eviction := v1beta1.Eviction{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: version,
+			Kind:       "Eviction",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: &metav1.DeleteOptions{
+			GracePeriodSeconds: gracePeriod,
+		},
+	}
+
+	// policy/v1 and policy/v1beta1 Evictions only differ in their apiVersion,
+	// so the body is encoded by hand instead of through the typed client
+	body, err := json.Marshal(&eviction)
+	if err != nil {
+		return err
+	}
+
+	err = client.CoreV1().RESTClient().Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("eviction").
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		Context(ctx).
+		Do().
+		Error()
+
+	switch {
+	case err == nil:
+		return nil
+	case apierrors.IsNotFound(err):
+		defaultLogger.Info("pod is already gone", "pod", podName(pod))
+		return nil
+	case apierrors.IsTooManyRequests(err):
+		return fmt.Errorf("%w: %s/%s: %s", ErrEvictionBlocked, pod.Namespace, pod.Name, err.Error())
+	default:
+		return fmt.Errorf("could not evict %s/%s using %s: %s", pod.Namespace, pod.Name, version, err.Error())
+	}
+}
+
+// evictionGracePeriod returns the grace period to evict pod with: the pod's
+// terminationGracePeriodSeconds if override is nil, else override. Zero or
+// negative values are sent as 0, which the API server treats as immediate
+// deletion.
+func evictionGracePeriod(pod *v1.Pod, override *int64) *int64 {
+	gracePeriod := override
+	if gracePeriod == nil {
+		gracePeriod = pod.Spec.TerminationGracePeriodSeconds
+	}
+	if gracePeriod == nil {
+		return nil
+	}
+
+	seconds := *gracePeriod
+	if seconds < 0 {
+		seconds = 0
+	}
+	return &seconds
+}
+
+// evictionVersion returns the newest Eviction version served by the cluster.
+func evictionVersion(client kubernetes.Interface) string {
+	resources, err := client.Discovery().ServerResourcesForGroupVersion(evictionV1)
+	if err != nil || resources == nil {
+		return evictionV1beta1
+	}
+	return evictionV1
+}
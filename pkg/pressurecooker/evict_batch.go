@@ -0,0 +1,113 @@
+package pressurecooker
+
+import (
+	"math"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// BatchPolicy picks the pods to evict for a single pressure event. severity
+// is how many percentage points the pressure is above the eviction threshold,
+// candidates are the evictable pods in the order they would be selected as a
+// batch, see SelectCandidatesForEviction. Policies usually return a prefix of
+// candidates; pods that are not candidates are ignored.
+type BatchPolicy func(severity float64, candidates PodCandidateSet) []*v1.Pod
+
+// BatchLimiter is implemented by scorers whose verdict depends on the other
+// pods of the same batch, e.g. DisruptionBudgetScorer. Limit returns a
+// function that is called with the candidates of one batch in order and
+// reports whether the pod can be evicted along with the ones admitted before.
+type BatchLimiter interface {
+	Limit() func(pod *v1.Pod) bool
+}
+
+// DefaultBatchPolicy evicts one pod up to 10 percentage points above the
+// threshold and one more for every further 10 points, at most three.
+var DefaultBatchPolicy = StepBatchPolicy(10, 3)
+
+// StepBatchPolicy evicts one pod, plus one for every step percentage points
+// the pressure is above the threshold, up to max pods.
+func StepBatchPolicy(step float64, max int) BatchPolicy {
+	return func(severity float64, candidates PodCandidateSet) []*v1.Pod {
+		n := 1
+		if step > 0 && severity > 0 {
+			n += int(math.Floor(severity / step))
+		}
+		if n > max {
+			n = max
+		}
+		if n > len(candidates) {
+			n = len(candidates)
+		}
+		if n < 0 {
+			n = 0
+		}
+		return candidates[:n].Pods()
+	}
+}
+
+// Pods returns the pods of the candidates, keeping their order.
+func (s PodCandidateSet) Pods() []*v1.Pod {
+	pods := make([]*v1.Pod, len(s))
+	for i := range s {
+		pods[i] = s[i].Pod
+	}
+	return pods
+}
+
+// SelectBatchForEviction scores all candidates and returns the ones policy
+// picks for the given severity, in the order returned by the policy. A nil cfg
+// uses DefaultScoringConfig.
+func (s PodCandidateSet) SelectBatchForEviction(minPodAge time.Duration, severity float64, policy BatchPolicy, cfg *ScoringConfig) PodCandidateSet {
+	if cfg == nil {
+		cfg = DefaultScoringConfig()
+	}
+
+	ranking := s.EvaluateOnly(minPodAge, cfg).batch(len(s), cfg).limit(cfg)
+	index := make(map[*v1.Pod]int, len(ranking))
+	for i := range ranking {
+		index[ranking[i].Pod] = i
+	}
+
+	pods := policy(severity, ranking)
+	selected := make(PodCandidateSet, 0, len(pods))
+	for _, pod := range pods {
+		i, ok := index[pod]
+		if !ok {
+			cfg.log().Info("batch policy picked a pod that is not evictable, ignoring it", "pod", podName(pod))
+			continue
+		}
+		delete(index, pod)
+		ranking[i].selected(cfg)
+		selected = append(selected, ranking[i])
+	}
+	return selected
+}
+
+// limit drops the candidates a BatchLimiter of cfg does not admit after the
+// ones before them, so any pods policy picks can be evicted together.
+func (s PodCandidateSet) limit(cfg *ScoringConfig) PodCandidateSet {
+	var admit []func(pod *v1.Pod) bool
+	for _, scorer := range cfg.Scorers {
+		if l, ok := scorer.(BatchLimiter); ok {
+			admit = append(admit, l.Limit())
+		}
+	}
+	if len(admit) == 0 {
+		return s
+	}
+
+	limited := make(PodCandidateSet, 0, len(s))
+candidates:
+	for i := range s {
+		for _, fn := range admit {
+			if !fn(s[i].Pod) {
+				cfg.log().Info("skipping candidate, the batch already used its budget", "pod", podName(s[i].Pod))
+				continue candidates
+			}
+		}
+		limited = append(limited, s[i])
+	}
+	return limited
+}
@@ -0,0 +1,92 @@
+package pressurecooker
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func budget(name string, app string, allowed int32) v1beta1.PodDisruptionBudget {
+	return v1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       v1beta1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}}},
+		Status:     v1beta1.PodDisruptionBudgetStatus{PodDisruptionsAllowed: allowed},
+	}
+}
+
+func appPod(name, app string) *v1.Pod {
+	pod := evictablePod(name, types.UID("rs-"+name), time.Hour)
+	pod.Labels = map[string]string{"app": app}
+	return pod
+}
+
+func TestBatchWithinDisruptionBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		budgets  []v1beta1.PodDisruptionBudget
+		pods     []*v1.Pod
+		selected []string
+	}{
+		{
+			name:     "one disruption for two pods",
+			budgets:  []v1beta1.PodDisruptionBudget{budget("web", "web", 1)},
+			pods:     []*v1.Pod{appPod("a", "web"), appPod("b", "web")},
+			selected: []string{"a"},
+		},
+		{
+			name:     "two disruptions for two pods",
+			budgets:  []v1beta1.PodDisruptionBudget{budget("web", "web", 2)},
+			pods:     []*v1.Pod{appPod("a", "web"), appPod("b", "web")},
+			selected: []string{"a", "b"},
+		},
+		{
+			name:     "pods without a budget fill the batch",
+			budgets:  []v1beta1.PodDisruptionBudget{budget("web", "web", 1)},
+			pods:     []*v1.Pod{appPod("a", "web"), appPod("b", "web"), appPod("c", "db")},
+			selected: []string{"a", "c"},
+		},
+		{
+			name: "every budget of a pod must allow it",
+			budgets: []v1beta1.PodDisruptionBudget{
+				budget("web", "web", 2),
+				{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "all"},
+					Spec:       v1beta1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: metav1.LabelSelectorOpExists}}}},
+					Status:     v1beta1.PodDisruptionBudgetStatus{PodDisruptionsAllowed: 1},
+				},
+			},
+			pods:     []*v1.Pod{appPod("a", "web"), appPod("b", "web")},
+			selected: []string{"a"},
+		},
+		{
+			name:     "exhausted budget",
+			budgets:  []v1beta1.PodDisruptionBudget{budget("web", "web", 0)},
+			pods:     []*v1.Pod{appPod("a", "web"), appPod("b", "db")},
+			selected: []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testScoringConfig()
+			cfg.Scorers = append(cfg.Scorers, NewDisruptionBudgetScorer(tt.budgets))
+
+			selected := PodCandidateSetFromPods(tt.pods).SelectBatchForEviction(0, 100, StepBatchPolicy(1, 10), cfg)
+			var names []string
+			for _, c := range selected {
+				names = append(names, c.Pod.Name)
+			}
+			if len(names) != len(tt.selected) {
+				t.Fatalf("expected %v, got %v", tt.selected, names)
+			}
+			for i := range names {
+				if names[i] != tt.selected[i] {
+					t.Errorf("expected %v, got %v", tt.selected, names)
+				}
+			}
+		})
+	}
+}
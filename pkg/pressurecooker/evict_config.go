@@ -0,0 +1,211 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+)
+
+// ScoringConfig holds the weights used when scoring eviction candidates. Each
+// weight is added to the score of a pod matching the dimension; pods with a
+// total below MinScore are never evicted. A weight of Veto rules out matching
+// pods regardless of their score.
+type ScoringConfig struct {
+	// UseAge, UseQOS, UseOwnerType and UseCriticality enable the builtin
+	// dimensions of the same name. Note that disabling the age dimension
+	// also disables the minimum pod age.
+	UseAge         bool
+	UseQOS         bool
+	UseOwnerType   bool
+	UseCriticality bool
+
+	// The QoS weights follow the kubelet's eviction order: BestEffort pods
+	// are the cheapest to evict, Guaranteed pods are evicted last.
+	QOSBestEffort int
+	QOSBurstable  int
+	QOSGuaranteed int
+
+	// NoStartTime applies to pods that have not been started yet, TooYoung
+	// to pods younger than MinPodAge. The minimum age passed to the
+	// selection methods overrides MinPodAge if not zero.
+	NoStartTime int
+	TooYoung    int
+	MinPodAge   time.Duration
+
+	Unowned     int
+	ReplicaSet  int
+	Deployment  int
+	StatefulSet int
+	DaemonSet   int
+	Job         int
+	CronJob     int
+
+	KubeSystem            int
+	CriticalPriorityClass int
+	CriticalPodAnnotation int
+	// PriorityFactor lowers the score by the pod's priority multiplied by
+	// the factor, e.g. 0.01 subtracts 10 for a priority of 1000.
+	PriorityFactor float64
+
+	// LocalStorage applies to pods using disk backed emptyDir or hostPath
+	// volumes, which lose their data when evicted.
+	LocalStorage int
+	// PersistentVolumeClaim applies to pods referencing a claim, which might
+	// not be schedulable elsewhere until the volume is detached.
+	PersistentVolumeClaim int
+
+	// NotReady applies to pods whose Ready condition is not true.
+	NotReady int
+	// Initializing applies to pods whose init containers did not all
+	// complete successfully yet.
+	Initializing int
+
+	// BroadToleration applies to pods tolerating all taints or the
+	// pressurecooker taint, which would likely be rescheduled onto the same
+	// node. Zero disables it.
+	BroadToleration int
+
+	// Restarts applies to pods whose containers restarted at least
+	// RestartThreshold times in total. A threshold of zero disables it.
+	Restarts         int
+	RestartThreshold int32
+
+	// Excluded and Preferred apply to pods opting out of or into eviction
+	// through ExcludeAnnotation and PreferAnnotation.
+	Excluded  int
+	Preferred int
+
+	// SameOwner applies to the remaining pods of a controller once one of its
+	// pods was selected in the same batch, see SelectCandidatesForEviction.
+	// It is added once per selected sibling. Zero disables it.
+	SameOwner int
+
+	// MinScore is the lowest total score of a pod that is evicted, zero by
+	// default. Raising it requires a stronger signal before evicting.
+	MinScore int
+
+	// Namespaces restricts the candidates to pods in these namespaces if not
+	// empty. Pods in ExcludedNamespaces are never candidates.
+	Namespaces         []string
+	ExcludedNamespaces []string
+
+	// OwnerResolver optionally resolves owners to their own controllers, so
+	// the top-level controller of a pod is scored as well.
+	OwnerResolver OwnerResolver
+
+	// Scorers are custom dimensions added on top of the builtin ones.
+	Scorers []Scorer
+
+	// Allocatable is the node's allocatable, usually its status.allocatable.
+	// If set, every candidate's PodCandidate.Impact is estimated against it.
+	Allocatable v1.ResourceList
+
+	// Order optionally replaces the ranking by descending score, e.g. to
+	// prefer the youngest evictable pod. It reports whether a ranks before
+	// b; vetoed pods and pods below MinScore are still never selected.
+	Order func(a, b PodCandidate) bool
+
+	// Clock returns the time pod ages are measured against, time.Now if nil.
+	Clock func() time.Time
+
+	// Logger receives the scoring and selection decisions, glog if nil.
+	Logger logr.Logger
+}
+
+func DefaultScoringConfig() *ScoringConfig {
+	return &ScoringConfig{
+		UseAge:         true,
+		UseQOS:         true,
+		UseOwnerType:   true,
+		UseCriticality: true,
+
+		QOSBestEffort: 200,
+		QOSBurstable:  100,
+		QOSGuaranteed: -100,
+
+		NoStartTime: Veto,
+		TooYoung:    Veto,
+		MinPodAge:   10 * time.Minute,
+
+		Unowned:     -1000,
+		ReplicaSet:  100,
+		Deployment:  0,
+		StatefulSet: Veto,
+		DaemonSet:   Veto,
+		Job:         Veto,
+		CronJob:     Veto,
+
+		KubeSystem:            Veto,
+		CriticalPriorityClass: Veto,
+		CriticalPodAnnotation: Veto,
+
+		LocalStorage:          -100,
+		PersistentVolumeClaim: -500,
+
+		NotReady:     -1000,
+		Initializing: -1000,
+
+		Restarts:         -500,
+		RestartThreshold: 5,
+
+		Excluded:  Veto,
+		Preferred: 1000,
+
+		SameOwner: -1000,
+	}
+}
+
+func (cfg *ScoringConfig) now() time.Time {
+	if cfg.Clock == nil {
+		return time.Now()
+	}
+	return cfg.Clock()
+}
+
+func (cfg *ScoringConfig) minScore() int {
+	if cfg == nil {
+		return 0
+	}
+	return cfg.MinScore
+}
+
+func (cfg *ScoringConfig) log() logr.Logger {
+	if cfg == nil {
+		return defaultLogger
+	}
+	return loggerOr(cfg.Logger)
+}
+
+// Validate checks the configuration for invalid or contradicting values.
+func (cfg *ScoringConfig) Validate() error {
+	if cfg.RestartThreshold < 0 {
+		return fmt.Errorf("restart threshold must not be negative, got %d", cfg.RestartThreshold)
+	}
+	if cfg.MinPodAge < 0 {
+		return fmt.Errorf("minimum pod age must not be negative, got %s", cfg.MinPodAge)
+	}
+	if cfg.MinScore < 0 {
+		return fmt.Errorf("minimum score must not be negative, got %d", cfg.MinScore)
+	}
+	if cfg.PriorityFactor < 0 {
+		return fmt.Errorf("priority factor must not be negative, got %f", cfg.PriorityFactor)
+	}
+
+	excluded := make(map[string]bool, len(cfg.ExcludedNamespaces))
+	for _, ns := range cfg.ExcludedNamespaces {
+		excluded[ns] = true
+	}
+	for _, ns := range cfg.Namespaces {
+		if excluded[ns] {
+			return fmt.Errorf("namespace %q is both included and excluded", ns)
+		}
+	}
+
+	if !cfg.UseAge && !cfg.UseQOS && !cfg.UseOwnerType && !cfg.UseCriticality && len(cfg.Scorers) == 0 {
+		return fmt.Errorf("all builtin scoring dimensions are disabled and no scorers are configured")
+	}
+
+	return nil
+}
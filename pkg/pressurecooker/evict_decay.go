@@ -0,0 +1,40 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// AgeDecay maps how far a pod is through the grace period after the minimum
+// pod age, from 0 at the minimum age to 1 at its end, to the share of the
+// weight of a RecentPodScorer the pod still gets.
+type AgeDecay func(progress float64) float64
+
+// LinearDecay lowers the weight evenly over the grace period.
+func LinearDecay(progress float64) float64 {
+	return 1 - progress
+}
+
+// CosineDecay lowers the weight slowly right after the minimum age and at the
+// end of the grace period, and fastest in between.
+func CosineDecay(progress float64) float64 {
+	return (1 + math.Cos(math.Pi*progress)) / 2
+}
+
+// StepDecay keeps the full weight for the whole grace period.
+func StepDecay(progress float64) float64 {
+	return 1
+}
+
+func ParseAgeDecay(s string) (AgeDecay, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "linear":
+		return LinearDecay, nil
+	case "cosine":
+		return CosineDecay, nil
+	case "step":
+		return StepDecay, nil
+	}
+	return nil, fmt.Errorf("unknown age decay %q, expected linear, cosine or step", s)
+}
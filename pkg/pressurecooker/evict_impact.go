@@ -0,0 +1,45 @@
+package pressurecooker
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// EvictionImpact is a what-if estimate of the relief of evicting a pod: its
+// cpu and memory requests as a fraction of the node's allocatable, between 0
+// and 1. Pods without requests free no guaranteed capacity, evicting them
+// might not move the needle.
+type EvictionImpact struct {
+	CPU    float64
+	Memory float64
+}
+
+// For returns the impact on resource r, zero for io.
+func (i EvictionImpact) For(r Resource) float64 {
+	switch r {
+	case ResourceCPU:
+		return i.CPU
+	case ResourceMemory:
+		return i.Memory
+	}
+	return 0
+}
+
+// EstimateImpact estimates the impact of evicting pod from a node with the
+// given allocatable. Resources without allocatable have no impact.
+func EstimateImpact(pod *v1.Pod, allocatable v1.ResourceList) EvictionImpact {
+	var impact EvictionImpact
+	if q, ok := allocatable[v1.ResourceCPU]; ok && q.MilliValue() > 0 {
+		impact.CPU = fraction(podRequest(pod, ResourceCPU), q.MilliValue())
+	}
+	if q, ok := allocatable[v1.ResourceMemory]; ok && q.Value() > 0 {
+		impact.Memory = fraction(podRequest(pod, ResourceMemory), q.Value())
+	}
+	return impact
+}
+
+func fraction(part, total int64) float64 {
+	if part >= total {
+		return 1
+	}
+	return float64(part) / float64(total)
+}
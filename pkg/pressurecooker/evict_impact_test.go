@@ -0,0 +1,70 @@
+package pressurecooker
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func podWithRequests(cpu, memory string) *v1.Pod {
+	requests := v1.ResourceList{}
+	if cpu != "" {
+		requests[v1.ResourceCPU] = resource.MustParse(cpu)
+	}
+	if memory != "" {
+		requests[v1.ResourceMemory] = resource.MustParse(memory)
+	}
+	return &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{
+		{Resources: v1.ResourceRequirements{Requests: requests}},
+	}}}
+}
+
+func TestEstimateImpact(t *testing.T) {
+	allocatable := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("4"),
+		v1.ResourceMemory: resource.MustParse("8Gi"),
+	}
+
+	tests := []struct {
+		name        string
+		pod         *v1.Pod
+		allocatable v1.ResourceList
+		cpu, memory float64
+	}{
+		{"no requests", podWithRequests("", ""), allocatable, 0, 0},
+		{"cpu and memory", podWithRequests("1", "2Gi"), allocatable, 0.25, 0.25},
+		{"tiny pod", podWithRequests("40m", "80Mi"), allocatable, 0.01, 80.0 / 8192},
+		{"above allocatable", podWithRequests("8", "16Gi"), allocatable, 1, 1},
+		{"no allocatable", podWithRequests("1", "2Gi"), v1.ResourceList{}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			impact := EstimateImpact(tt.pod, tt.allocatable)
+			if impact.CPU != tt.cpu || impact.Memory != tt.memory {
+				t.Errorf("got cpu=%f memory=%f, want cpu=%f memory=%f", impact.CPU, impact.Memory, tt.cpu, tt.memory)
+			}
+			if impact.For(ResourceIO) != 0 {
+				t.Errorf("io impact must be zero, got %f", impact.For(ResourceIO))
+			}
+		})
+	}
+}
+
+func TestEvaluateOnlyEstimatesImpact(t *testing.T) {
+	s := PodCandidateSetFromPods([]*v1.Pod{podWithRequests("1", "")})
+
+	for _, c := range s.EvaluateOnly(0, DefaultScoringConfig()) {
+		if c.Impact != nil {
+			t.Errorf("impact estimated without allocatable")
+		}
+	}
+
+	cfg := DefaultScoringConfig()
+	cfg.Allocatable = v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}
+	for _, c := range s.EvaluateOnly(0, cfg) {
+		if c.Impact == nil || c.Impact.CPU != 0.5 {
+			t.Errorf("expected a cpu impact of 0.5, got %v", c.Impact)
+		}
+	}
+}
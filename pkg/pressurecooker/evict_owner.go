@@ -0,0 +1,59 @@
+package pressurecooker
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// OwnerResolver returns the controller of an owner in the given namespace,
+// e.g. the Deployment of a ReplicaSet or the CronJob of a Job. It returns
+// false if the owner has no controller or it could not be resolved.
+type OwnerResolver func(namespace string, owner metav1.OwnerReference) (metav1.OwnerReference, bool)
+
+// maxOwnerDepth bounds the walk up the owner chain.
+const maxOwnerDepth = 5
+
+// topLevelOwner walks the owner chain up to the top-level controller.
+func topLevelOwner(resolve OwnerResolver, namespace string, owner metav1.OwnerReference) metav1.OwnerReference {
+	if resolve == nil {
+		return owner
+	}
+
+	for i := 0; i < maxOwnerDepth; i++ {
+		parent, ok := resolve(namespace, owner)
+		if !ok {
+			break
+		}
+		owner = parent
+	}
+
+	return owner
+}
+
+// NewOwnerResolver returns an OwnerResolver looking up ReplicaSets and Jobs
+// through the API server.
+func NewOwnerResolver(client kubernetes.Interface) OwnerResolver {
+	return func(namespace string, owner metav1.OwnerReference) (metav1.OwnerReference, bool) {
+		var obj metav1.Object
+		var err error
+
+		switch owner.Kind {
+		case "ReplicaSet":
+			obj, err = client.AppsV1().ReplicaSets(namespace).Get(owner.Name, metav1.GetOptions{})
+		case "Job":
+			obj, err = client.BatchV1().Jobs(namespace).Get(owner.Name, metav1.GetOptions{})
+		default:
+			return metav1.OwnerReference{}, false
+		}
+
+		if err != nil {
+			return metav1.OwnerReference{}, false
+		}
+
+		parent := metav1.GetControllerOf(obj)
+		if parent == nil {
+			return metav1.OwnerReference{}, false
+		}
+		return *parent, true
+	}
+}
@@ -0,0 +1,76 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScoringProfile names a curated set of scoring weights, see Config. The
+// returned configuration can still be tuned weight by weight.
+type ScoringProfile string
+
+const (
+	// ProfileDefault is DefaultScoringConfig.
+	ProfileDefault ScoringProfile = "default"
+	// ProfileConservative only evicts pods that are clearly safe to move:
+	// old replicated pods without local data or volumes. Nodes may stay
+	// under pressure if there is no such pod.
+	ProfileConservative ScoringProfile = "conservative"
+	// ProfileAggressive relieves the pressure quickly: younger pods, bare
+	// pods and pods with volumes or local storage become candidates.
+	// Stateful sets, daemon sets and critical pods are still never evicted.
+	ProfileAggressive ScoringProfile = "aggressive"
+	// ProfileBatchFriendly protects long running batch work, which loses
+	// its progress when evicted: jobs and bare pods are never evicted and
+	// BestEffort pods, often batch work, are no longer preferred. Replicated
+	// services, which are rescheduled quickly, are evicted first.
+	ProfileBatchFriendly ScoringProfile = "batch-friendly"
+)
+
+func (p ScoringProfile) String() string {
+	return string(p)
+}
+
+func ParseScoringProfile(s string) (ScoringProfile, error) {
+	switch p := ScoringProfile(strings.ToLower(strings.TrimSpace(s))); p {
+	case ProfileDefault, ProfileConservative, ProfileAggressive, ProfileBatchFriendly:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown scoring profile %q, expected default, conservative, aggressive or batch-friendly", s)
+}
+
+// Config returns a new scoring configuration with the weights of the
+// profile, DefaultScoringConfig for unknown profiles.
+func (p ScoringProfile) Config() *ScoringConfig {
+	cfg := DefaultScoringConfig()
+	switch p {
+	case ProfileConservative:
+		cfg.MinPodAge = 30 * time.Minute
+		cfg.MinScore = 100
+		cfg.Unowned = Veto
+		cfg.LocalStorage = Veto
+		cfg.PersistentVolumeClaim = Veto
+		cfg.Restarts = -1000
+		cfg.SameOwner = Veto
+
+	case ProfileAggressive:
+		cfg.MinPodAge = 2 * time.Minute
+		cfg.QOSGuaranteed = 0
+		cfg.Unowned = -100
+		cfg.LocalStorage = 0
+		cfg.PersistentVolumeClaim = -100
+		cfg.NotReady = 0
+		cfg.Initializing = -100
+		cfg.Restarts = 0
+
+	case ProfileBatchFriendly:
+		cfg.QOSBestEffort = 100
+		cfg.Unowned = Veto
+		cfg.ReplicaSet = 300
+		cfg.Deployment = 100
+		cfg.Job = Veto
+		cfg.CronJob = Veto
+	}
+	return cfg
+}
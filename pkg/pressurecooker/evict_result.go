@@ -0,0 +1,93 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// SelectionResult explains the outcome of a selection, e.g. to be surfaced
+// in a status condition of the node.
+type SelectionResult struct {
+	// Candidate is the selected candidate, nil if no pod was selected.
+	Candidate *PodCandidate
+	// Candidates is the number of pods to choose from, Filtered the number of
+	// them dropped before scoring, e.g. terminating pods or pods in excluded
+	// namespaces.
+	Candidates int
+	Filtered   int
+	// Vetoed counts the pods that were vetoed or scored below the minimum
+	// score by the dimension that vetoed them or lowered their score the
+	// most.
+	Vetoed map[string]int
+	// Reason tells why no pod was selected, empty if one was.
+	Reason string
+}
+
+// Pod returns the selected pod, nil if none was selected.
+func (r *SelectionResult) Pod() *v1.Pod {
+	if r.Candidate == nil {
+		return nil
+	}
+	return r.Candidate.Pod
+}
+
+// ExplainSelection selects a pod like SelectCandidateForEviction and reports
+// how the candidates fared.
+func (s PodCandidateSet) ExplainSelection(minPodAge time.Duration, cfg *ScoringConfig) SelectionResult {
+	ranking := s.EvaluateOnly(minPodAge, cfg)
+	minScore := cfg.minScore()
+
+	r := SelectionResult{
+		Candidates: len(s),
+		Filtered:   len(s) - len(ranking),
+		Vetoed:     make(map[string]int),
+	}
+	for i := range ranking {
+		if ranking[i].Vetoed() || ranking[i].Score < minScore {
+			r.Vetoed[ranking[i].vetoedBy()]++
+		}
+	}
+
+	if selected := ranking.selectTop(1, cfg); len(selected) > 0 {
+		r.Candidate = &selected[0]
+		return r
+	}
+
+	switch {
+	case len(s) == 0:
+		r.Reason = "there are no pods to evict"
+	case len(ranking) == 0:
+		r.Reason = fmt.Sprintf("all %d pods were filtered", len(s))
+	default:
+		r.Reason = fmt.Sprintf("none of %d pods scored at least %d, vetoed by %v", len(ranking), minScore, r.Vetoed)
+	}
+	return r
+}
+
+// vetoedBy returns the first vetoing dimension, else the dimension with the
+// lowest contribution to the score, the first by name among equal ones.
+func (c *PodCandidate) vetoedBy() string {
+	if c.Vetoed() {
+		return c.Vetoes[0]
+	}
+
+	dimensions := make([]string, 0, len(c.Breakdown))
+	for d := range c.Breakdown {
+		dimensions = append(dimensions, d)
+	}
+	if len(dimensions) == 0 {
+		return "none"
+	}
+	sort.Strings(dimensions)
+
+	lowest := dimensions[0]
+	for _, d := range dimensions[1:] {
+		if c.Breakdown[d] < c.Breakdown[lowest] {
+			lowest = d
+		}
+	}
+	return lowest
+}
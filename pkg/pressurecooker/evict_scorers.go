@@ -0,0 +1,609 @@
+package pressurecooker
+
+import (
+	"math"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ResourceUsage is the current consumption of a pod, e.g. as reported by
+// metrics.k8s.io.
+type ResourceUsage struct {
+	CPU    resource.Quantity
+	Memory resource.Quantity
+}
+
+// UsageScorer raises the eviction score of pods by their cpu and memory
+// usage relative to the biggest consumer. The biggest consumer of both gets
+// Weight, pods without usage data are scored neutral.
+type UsageScorer struct {
+	Usage  map[types.NamespacedName]ResourceUsage
+	Weight int
+
+	maxCPU    int64
+	maxMemory int64
+}
+
+func NewUsageScorer(usage map[types.NamespacedName]ResourceUsage, weight int) *UsageScorer {
+	u := &UsageScorer{
+		Usage:  usage,
+		Weight: weight,
+	}
+
+	for _, pu := range usage {
+		if cpu := pu.CPU.MilliValue(); cpu > u.maxCPU {
+			u.maxCPU = cpu
+		}
+		if mem := pu.Memory.Value(); mem > u.maxMemory {
+			u.maxMemory = mem
+		}
+	}
+
+	return u
+}
+
+func (u *UsageScorer) Score(pod *v1.Pod) int {
+	usage, ok := u.Usage[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}]
+	if !ok {
+		return 0
+	}
+
+	share := 0.0
+	if u.maxCPU > 0 {
+		share += float64(usage.CPU.MilliValue()) / float64(u.maxCPU)
+	}
+	if u.maxMemory > 0 {
+		share += float64(usage.Memory.Value()) / float64(u.maxMemory)
+	}
+
+	return int(math.Round(share / 2 * float64(u.Weight)))
+}
+
+// MemoryRequestScorer raises the eviction score of pods using more memory
+// than they requested. A pod using MaxRatio times its request or more gets
+// Weight, pods within their request are scored neutral. Pods without a memory
+// request get NoRequest, pods without usage data are scored neutral.
+type MemoryRequestScorer struct {
+	Usage     map[types.NamespacedName]ResourceUsage
+	Weight    int
+	MaxRatio  float64
+	NoRequest int
+}
+
+// NewMemoryRequestScorer creates a scorer giving Weight to pods using four
+// times their memory request; pods without a request are treated like the
+// worst offenders.
+func NewMemoryRequestScorer(usage map[types.NamespacedName]ResourceUsage, weight int) *MemoryRequestScorer {
+	return &MemoryRequestScorer{
+		Usage:     usage,
+		Weight:    weight,
+		MaxRatio:  4,
+		NoRequest: weight,
+	}
+}
+
+func (m *MemoryRequestScorer) Score(pod *v1.Pod) int {
+	usage, ok := m.Usage[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}]
+	if !ok {
+		return 0
+	}
+
+	request := int64(0)
+	for _, c := range pod.Spec.Containers {
+		if q, ok := c.Resources.Requests[v1.ResourceMemory]; ok {
+			request += q.Value()
+		}
+	}
+	if request <= 0 {
+		return m.NoRequest
+	}
+
+	ratio := float64(usage.Memory.Value()) / float64(request)
+	if ratio <= 1 || m.MaxRatio <= 1 {
+		return 0
+	}
+
+	over := math.Min(ratio, m.MaxRatio) - 1
+	return int(math.Round(over / (m.MaxRatio - 1) * float64(m.Weight)))
+}
+
+// MemoryLimitScorer raises the eviction score of pods whose memory usage is
+// close to their limit; they are about to be OOM killed anyway, and evicting
+// them first can prevent a kernel OOM killing an innocent neighbor. Pods using
+// MinRatio of their limit are scored neutral, pods at or above their limit get
+// Weight. Pods without a memory limit on every container, i.e. without an
+// effective limit, or without usage data are scored neutral.
+type MemoryLimitScorer struct {
+	Usage    map[types.NamespacedName]ResourceUsage
+	Weight   int
+	MinRatio float64
+}
+
+// NewMemoryLimitScorer creates a scorer starting at 90% of the memory limit.
+func NewMemoryLimitScorer(usage map[types.NamespacedName]ResourceUsage, weight int) *MemoryLimitScorer {
+	return &MemoryLimitScorer{
+		Usage:    usage,
+		Weight:   weight,
+		MinRatio: 0.9,
+	}
+}
+
+func (m *MemoryLimitScorer) Score(pod *v1.Pod) int {
+	usage, ok := m.Usage[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}]
+	if !ok || m.MinRatio >= 1 {
+		return 0
+	}
+
+	limit := int64(0)
+	for _, c := range pod.Spec.Containers {
+		q, ok := c.Resources.Limits[v1.ResourceMemory]
+		if !ok {
+			return 0
+		}
+		limit += q.Value()
+	}
+	if limit <= 0 {
+		return 0
+	}
+
+	ratio := float64(usage.Memory.Value()) / float64(limit)
+	if ratio <= m.MinRatio {
+		return 0
+	}
+
+	near := (math.Min(ratio, 1) - m.MinRatio) / (1 - m.MinRatio)
+	return int(math.Round(near * float64(m.Weight)))
+}
+
+// PressureScorer scores pods by their own pressure, e.g. the pressure of their
+// cgroup read with Watcher.PodPressure, relative to the most pressured pod.
+// The most pressured pod gets Culprit, pods without pressure get Neighbor, the
+// other pods a blend of both by their share. Evicting the culprit relieves
+// the node the most, but moves the problem to another node; evicting a good
+// neighbor protects it from the culprit and is usually rescheduled without
+// trouble. Pods without pressure data are scored neutral.
+type PressureScorer struct {
+	Pressure map[types.NamespacedName]float64
+	Culprit  int
+	Neighbor int
+
+	max float64
+}
+
+func NewPressureScorer(pressure map[types.NamespacedName]float64, culprit, neighbor int) *PressureScorer {
+	p := &PressureScorer{
+		Pressure: pressure,
+		Culprit:  culprit,
+		Neighbor: neighbor,
+	}
+	for _, v := range pressure {
+		if v > p.max {
+			p.max = v
+		}
+	}
+	return p
+}
+
+// NewCulpritScorer creates a PressureScorer preferring the pods stalling the
+// most.
+func NewCulpritScorer(pressure map[types.NamespacedName]float64, weight int) *PressureScorer {
+	return NewPressureScorer(pressure, weight, 0)
+}
+
+// NewNeighborScorer creates a PressureScorer preferring the pods stalling the
+// least.
+func NewNeighborScorer(pressure map[types.NamespacedName]float64, weight int) *PressureScorer {
+	return NewPressureScorer(pressure, 0, weight)
+}
+
+func (p *PressureScorer) Score(pod *v1.Pod) int {
+	pressure, ok := p.Pressure[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}]
+	if !ok {
+		return 0
+	}
+
+	share := 0.0
+	if p.max > 0 {
+		share = pressure / p.max
+	}
+	return int(math.Round(share*float64(p.Culprit) + (1-share)*float64(p.Neighbor)))
+}
+
+// UsageSpike is the recent usage of a pod next to its long-term baseline,
+// e.g. the average of the last minutes and of the last days.
+type UsageSpike struct {
+	Recent   ResourceUsage
+	Baseline ResourceUsage
+}
+
+// SpikeScorer raises the eviction score of pods whose recent cpu or memory
+// usage spiked relative to their own baseline, regardless of their age. The
+// age dimension prefers long running pods as the well behaving neighbors to
+// move away; a pod that suddenly starts misbehaving after days is the bad
+// neighbor instead. Pods using MinRatio times their baseline are scored
+// neutral, MaxRatio times or more gets Weight. Pods without data or without a
+// baseline are scored neutral.
+type SpikeScorer struct {
+	Spikes   map[types.NamespacedName]UsageSpike
+	Weight   int
+	MinRatio float64
+	MaxRatio float64
+}
+
+// NewSpikeScorer creates a scorer giving Weight to pods using five times
+// their baseline, starting at twice the baseline.
+func NewSpikeScorer(spikes map[types.NamespacedName]UsageSpike, weight int) *SpikeScorer {
+	return &SpikeScorer{
+		Spikes:   spikes,
+		Weight:   weight,
+		MinRatio: 2,
+		MaxRatio: 5,
+	}
+}
+
+func (s *SpikeScorer) Score(pod *v1.Pod) int {
+	spike, ok := s.Spikes[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}]
+	if !ok || s.MaxRatio <= s.MinRatio {
+		return 0
+	}
+
+	ratio := 0.0
+	if base := spike.Baseline.CPU.MilliValue(); base > 0 {
+		ratio = math.Max(ratio, float64(spike.Recent.CPU.MilliValue())/float64(base))
+	}
+	if base := spike.Baseline.Memory.Value(); base > 0 {
+		ratio = math.Max(ratio, float64(spike.Recent.Memory.Value())/float64(base))
+	}
+	if ratio <= s.MinRatio {
+		return 0
+	}
+
+	over := math.Min(ratio, s.MaxRatio) - s.MinRatio
+	return int(math.Round(over / (s.MaxRatio - s.MinRatio) * float64(s.Weight)))
+}
+
+// RequestScorer raises the eviction score of pods by their request of the
+// resource under pressure relative to the biggest request, as evicting them
+// frees the most headroom: memory requests under memory pressure, cpu
+// requests under cpu pressure. The biggest request gets Weight, io pressure
+// is scored neutral.
+type RequestScorer struct {
+	Resource Resource
+	Weight   int
+
+	maxRequest int64
+}
+
+func NewRequestScorer(r Resource, pods []*v1.Pod, weight int) *RequestScorer {
+	s := &RequestScorer{
+		Resource: r,
+		Weight:   weight,
+	}
+
+	for _, pod := range pods {
+		if request := podRequest(pod, r); request > s.maxRequest {
+			s.maxRequest = request
+		}
+	}
+
+	return s
+}
+
+// podRequest returns the sum of the containers' requests of r in millicores
+// or bytes, zero for io.
+func podRequest(pod *v1.Pod, r Resource) int64 {
+	var total int64
+	for _, c := range pod.Spec.Containers {
+		switch r {
+		case ResourceCPU:
+			if q, ok := c.Resources.Requests[v1.ResourceCPU]; ok {
+				total += q.MilliValue()
+			}
+		case ResourceMemory:
+			if q, ok := c.Resources.Requests[v1.ResourceMemory]; ok {
+				total += q.Value()
+			}
+		}
+	}
+	return total
+}
+
+func (s *RequestScorer) Score(pod *v1.Pod) int {
+	if s.maxRequest <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(podRequest(pod, s.Resource)) / float64(s.maxRequest) * float64(s.Weight)))
+}
+
+// hostnameLabel is the well-known node label used as topology key for
+// spreading pods across nodes.
+const hostnameLabel = "kubernetes.io/hostname"
+
+// AffinityScorer scores pods by whether their scheduling constraints let them
+// reschedule elsewhere. Pods spread across nodes through pod anti-affinity
+// get Spread, as they land on another node and keep the spread. Pods pinned
+// to NodeName through a node selector or a required node affinity get
+// Pinned, as they would just come back.
+type AffinityScorer struct {
+	NodeName string
+	Spread   int
+	Pinned   int
+}
+
+func NewAffinityScorer(nodeName string) *AffinityScorer {
+	return &AffinityScorer{
+		NodeName: nodeName,
+		Spread:   100,
+		Pinned:   -1000,
+	}
+}
+
+func (a *AffinityScorer) Score(pod *v1.Pod) int {
+	if a.pinned(pod) {
+		return a.Pinned
+	}
+	if spreadByHostname(pod) {
+		return a.Spread
+	}
+	return 0
+}
+
+func (a *AffinityScorer) pinned(pod *v1.Pod) bool {
+	if pod.Spec.NodeSelector[hostnameLabel] == a.NodeName {
+		return true
+	}
+
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return false
+	}
+
+	// terms are ORed, the pod is pinned if every term only allows this node
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for _, term := range terms {
+		if !a.termPinned(term) {
+			return false
+		}
+	}
+	return len(terms) > 0
+}
+
+func (a *AffinityScorer) termPinned(term v1.NodeSelectorTerm) bool {
+	for _, r := range term.MatchExpressions {
+		if r.Key == hostnameLabel && r.Operator == v1.NodeSelectorOpIn && len(r.Values) == 1 && r.Values[0] == a.NodeName {
+			return true
+		}
+	}
+	for _, r := range term.MatchFields {
+		if r.Key == "metadata.name" && r.Operator == v1.NodeSelectorOpIn && len(r.Values) == 1 && r.Values[0] == a.NodeName {
+			return true
+		}
+	}
+	return false
+}
+
+func spreadByHostname(pod *v1.Pod) bool {
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.PodAntiAffinity == nil {
+		return false
+	}
+
+	for _, t := range affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+		if t.TopologyKey == hostnameLabel {
+			return true
+		}
+	}
+	for _, t := range affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		if t.PodAffinityTerm.TopologyKey == hostnameLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// DisruptionBudgetScorer applies Penalty to pods whose eviction would violate
+// a PodDisruptionBudget. A pod matched by several budgets is only evictable
+// if all of them allow another disruption. As a BatchLimiter it also keeps a
+// batch within the disruptions each budget allows.
+type DisruptionBudgetScorer struct {
+	Penalty int
+
+	budgets []disruptionBudget
+}
+
+type disruptionBudget struct {
+	namespace string
+	selector  labels.Selector
+	allowed   int32
+}
+
+func NewDisruptionBudgetScorer(budgets []v1beta1.PodDisruptionBudget) *DisruptionBudgetScorer {
+	d := &DisruptionBudgetScorer{
+		Penalty: Veto,
+		budgets: make([]disruptionBudget, 0, len(budgets)),
+	}
+
+	for i := range budgets {
+		b := &budgets[i]
+		if b.Spec.Selector == nil {
+			continue
+		}
+
+		sel, err := metav1.LabelSelectorAsSelector(b.Spec.Selector)
+		if err != nil {
+			defaultLogger.Info("ignoring pod disruption budget with an invalid selector", "budget", b.Namespace+"/"+b.Name, "error", err)
+			continue
+		}
+		// an empty selector matches no pods for policy/v1beta1
+		if sel.Empty() {
+			continue
+		}
+
+		d.budgets = append(d.budgets, disruptionBudget{
+			namespace: b.Namespace,
+			selector:  sel,
+			allowed:   b.Status.PodDisruptionsAllowed,
+		})
+	}
+
+	return d
+}
+
+func (d *DisruptionBudgetScorer) Score(pod *v1.Pod) int {
+	podLabels := labels.Set(pod.Labels)
+	for _, b := range d.budgets {
+		if b.namespace != pod.Namespace || !b.selector.Matches(podLabels) {
+			continue
+		}
+		if b.allowed < 1 {
+			return d.Penalty
+		}
+	}
+	return 0
+}
+
+func (d *DisruptionBudgetScorer) Limit() func(pod *v1.Pod) bool {
+	used := make([]int32, len(d.budgets))
+	return func(pod *v1.Pod) bool {
+		podLabels := labels.Set(pod.Labels)
+		var matched []int
+		for i, b := range d.budgets {
+			if b.namespace != pod.Namespace || !b.selector.Matches(podLabels) {
+				continue
+			}
+			if used[i] >= b.allowed {
+				return false
+			}
+			matched = append(matched, i)
+		}
+		for _, i := range matched {
+			used[i]++
+		}
+		return true
+	}
+}
+
+// ReplicaCount is the desired and the ready number of replicas of a workload.
+type ReplicaCount struct {
+	Desired int32
+	Ready   int32
+}
+
+// ReplicaScorer penalizes ready pods whose eviction would drop their
+// controller to zero ready replicas (LastReplica). Pods of controllers that
+// already have fewer ready replicas than desired, or that would drop below
+// MinReady ready replicas, get BelowDesired. Evicting a pod of a healthy
+// controller always leaves it one short until the pod is rescheduled, that
+// alone is not penalized. Replicas is keyed by the UID of the controller,
+// pods of unknown controllers are scored neutral.
+type ReplicaScorer struct {
+	Replicas     map[types.UID]ReplicaCount
+	LastReplica  int
+	BelowDesired int
+	// MinReady is the number of ready replicas to keep, zero disables it.
+	MinReady int32
+}
+
+func NewReplicaScorer(replicas map[types.UID]ReplicaCount) *ReplicaScorer {
+	return &ReplicaScorer{
+		Replicas:     replicas,
+		LastReplica:  -2000,
+		BelowDesired: -200,
+	}
+}
+
+func (r *ReplicaScorer) Score(pod *v1.Pod) int {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return 0
+	}
+	count, ok := r.Replicas[owner.UID]
+	if !ok || !isPodReady(pod) {
+		return 0
+	}
+
+	switch remaining := count.Ready - 1; {
+	case remaining <= 0:
+		return r.LastReplica
+	case count.Ready < count.Desired, remaining < r.MinReady:
+		return r.BelowDesired
+	}
+	return 0
+}
+
+// ReplicaCountsFromReplicaSets returns the replica counts of ReplicaSets and
+// StatefulSets for a ReplicaScorer.
+func ReplicaCountsFromReplicaSets(replicaSets []appsv1.ReplicaSet, statefulSets []appsv1.StatefulSet) map[types.UID]ReplicaCount {
+	counts := make(map[types.UID]ReplicaCount, len(replicaSets)+len(statefulSets))
+	for i := range replicaSets {
+		rs := &replicaSets[i]
+		counts[rs.UID] = ReplicaCount{Desired: desiredReplicas(rs.Spec.Replicas), Ready: rs.Status.ReadyReplicas}
+	}
+	for i := range statefulSets {
+		ss := &statefulSets[i]
+		counts[ss.UID] = ReplicaCount{Desired: desiredReplicas(ss.Spec.Replicas), Ready: ss.Status.ReadyReplicas}
+	}
+	return counts
+}
+
+// desiredReplicas defaults an unset replica count to one, like the API server.
+func desiredReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// RecentPodScorer softens the cliff of the minimum pod age: pods younger than
+// MinAge are vetoed by the age dimension, pods that just passed it would
+// otherwise become candidates right away. Pods within Window after MinAge get
+// Weight, usually negative, scaled by Decay over the window; younger and older
+// pods are scored neutral.
+type RecentPodScorer struct {
+	MinAge time.Duration
+	Window time.Duration
+	Weight int
+	// Decay is LinearDecay if nil.
+	Decay AgeDecay
+	// Clock returns the time pod ages are measured against, time.Now if nil.
+	Clock func() time.Time
+}
+
+// NewRecentPodScorer creates a scorer linearly decaying weight between
+// minPodAge and twice minPodAge.
+func NewRecentPodScorer(minPodAge time.Duration, weight int) *RecentPodScorer {
+	return &RecentPodScorer{
+		MinAge: minPodAge,
+		Window: minPodAge,
+		Weight: weight,
+		Decay:  LinearDecay,
+	}
+}
+
+func (r *RecentPodScorer) Score(pod *v1.Pod) int {
+	if r.Window <= 0 || pod.Status.StartTime == nil {
+		return 0
+	}
+	now := time.Now()
+	if r.Clock != nil {
+		now = r.Clock()
+	}
+	since := now.Sub(pod.Status.StartTime.Time) - r.MinAge
+	if since < 0 || since >= r.Window {
+		return 0
+	}
+
+	decay := r.Decay
+	if decay == nil {
+		decay = LinearDecay
+	}
+	share := math.Max(0, math.Min(decay(float64(since)/float64(r.Window)), 1))
+	return int(math.Round(share * float64(r.Weight)))
+}
@@ -0,0 +1,410 @@
+package pressurecooker
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var testNow = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func podStartedAgo(age time.Duration) *v1.Pod {
+	started := metav1.NewTime(testNow.Add(-age))
+	return &v1.Pod{Status: v1.PodStatus{StartTime: &started}}
+}
+
+func TestRecentPodScorer(t *testing.T) {
+	tests := []struct {
+		name  string
+		decay AgeDecay
+		age   time.Duration
+		score int
+	}{
+		{"younger than min age", LinearDecay, 9 * time.Minute, 0},
+		{"at min age", LinearDecay, 10 * time.Minute, -1000},
+		{"linear halfway", LinearDecay, 15 * time.Minute, -500},
+		{"linear near the end", LinearDecay, 19 * time.Minute, -100},
+		{"at twice min age", LinearDecay, 20 * time.Minute, 0},
+		{"cosine quarter", CosineDecay, 12*time.Minute + 30*time.Second, -854},
+		{"cosine halfway", CosineDecay, 15 * time.Minute, -500},
+		{"step near the end", StepDecay, 19 * time.Minute, -1000},
+		{"nil decay", nil, 15 * time.Minute, -500},
+		{"out of range decay", func(float64) float64 { return 2 }, 15 * time.Minute, -1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRecentPodScorer(10*time.Minute, -1000)
+			r.Decay = tt.decay
+			r.Clock = func() time.Time { return testNow }
+			if score := r.Score(podStartedAgo(tt.age)); score != tt.score {
+				t.Errorf("expected %d, got %d", tt.score, score)
+			}
+		})
+	}
+
+	r := NewRecentPodScorer(10*time.Minute, -1000)
+	if score := r.Score(&v1.Pod{}); score != 0 {
+		t.Errorf("pod without start time scored %d", score)
+	}
+	if score := NewRecentPodScorer(0, -1000).Score(podStartedAgo(time.Minute)); score != 0 {
+		t.Errorf("zero min age scored %d", score)
+	}
+}
+
+func TestParseAgeDecay(t *testing.T) {
+	for _, name := range []string{"linear", "Cosine", " step "} {
+		if _, err := ParseAgeDecay(name); err != nil {
+			t.Errorf("could not parse %q: %s", name, err)
+		}
+	}
+	if _, err := ParseAgeDecay("exponential"); err == nil {
+		t.Errorf("parsed an unknown decay")
+	}
+}
+
+func TestReplicaScorer(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    ReplicaCount
+		minReady int32
+		score    int
+	}{
+		{"single replica", ReplicaCount{Desired: 1, Ready: 1}, 0, -2000},
+		{"two replicas", ReplicaCount{Desired: 2, Ready: 2}, 0, 0},
+		{"two replicas, one ready", ReplicaCount{Desired: 2, Ready: 1}, 0, -2000},
+		{"twenty replicas", ReplicaCount{Desired: 20, Ready: 20}, 0, 0},
+		{"twenty replicas, one missing", ReplicaCount{Desired: 20, Ready: 19}, 0, -200},
+		{"twenty replicas above min ready", ReplicaCount{Desired: 20, Ready: 20}, 19, 0},
+		{"twenty replicas at min ready", ReplicaCount{Desired: 20, Ready: 20}, 20, -200},
+		{"more ready than desired", ReplicaCount{Desired: 2, Ready: 3}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReplicaScorer(map[types.UID]ReplicaCount{"rs": tt.count})
+			r.MinReady = tt.minReady
+			if score := r.Score(evictablePod("a", "rs", time.Hour)); score != tt.score {
+				t.Errorf("expected %d, got %d", tt.score, score)
+			}
+		})
+	}
+
+	r := NewReplicaScorer(map[types.UID]ReplicaCount{"rs": {Desired: 1, Ready: 1}})
+	if score := r.Score(evictablePod("a", "other", time.Hour)); score != 0 {
+		t.Errorf("pod of an unknown controller scored %d", score)
+	}
+	notReady := evictablePod("a", "rs", time.Hour)
+	notReady.Status.Conditions = nil
+	if score := r.Score(notReady); score != 0 {
+		t.Errorf("pod that is not ready scored %d", score)
+	}
+}
+
+func namedPod(name string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+}
+
+func podKey(name string) types.NamespacedName {
+	return types.NamespacedName{Namespace: "default", Name: name}
+}
+
+func usage(cpu, memory string) ResourceUsage {
+	return ResourceUsage{CPU: resource.MustParse(cpu), Memory: resource.MustParse(memory)}
+}
+
+func TestUsageScorer(t *testing.T) {
+	u := NewUsageScorer(map[types.NamespacedName]ResourceUsage{
+		podKey("biggest"): usage("2", "4Gi"),
+		podKey("cpu"):     usage("2", "0"),
+		podKey("half"):    usage("1", "2Gi"),
+		podKey("quarter"): usage("500m", "1Gi"),
+		podKey("idle"):    usage("0", "0"),
+	}, 100)
+
+	tests := []struct {
+		pod   string
+		score int
+	}{
+		{"biggest", 100},
+		{"cpu", 50},
+		{"half", 50},
+		{"quarter", 25},
+		{"idle", 0},
+		{"unknown", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pod, func(t *testing.T) {
+			if score := u.Score(namedPod(tt.pod)); score != tt.score {
+				t.Errorf("expected %d, got %d", tt.score, score)
+			}
+		})
+	}
+
+	if score := NewUsageScorer(nil, 100).Score(namedPod("a")); score != 0 {
+		t.Errorf("pod without usage data scored %d", score)
+	}
+}
+
+func requestPod(name string, requests ...string) *v1.Pod {
+	pod := namedPod(name)
+	for _, r := range requests {
+		pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{
+			Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse(r)}},
+		})
+	}
+	return pod
+}
+
+func TestMemoryRequestScorer(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage string
+		pod   *v1.Pod
+		score int
+	}{
+		{"within the request", "1Gi", requestPod("a", "1Gi"), 0},
+		{"twice the request", "2Gi", requestPod("a", "1Gi"), 33},
+		{"four times the request", "4Gi", requestPod("a", "1Gi"), 100},
+		{"beyond the max ratio", "16Gi", requestPod("a", "1Gi"), 100},
+		{"requests of all containers", "2Gi", requestPod("a", "512Mi", "512Mi"), 33},
+		{"no request", "1Mi", requestPod("a"), 100},
+		{"no usage data", "", requestPod("b", "1Gi"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usages := map[types.NamespacedName]ResourceUsage{}
+			if tt.usage != "" {
+				usages[podKey("a")] = usage("0", tt.usage)
+			}
+			if score := NewMemoryRequestScorer(usages, 100).Score(tt.pod); score != tt.score {
+				t.Errorf("expected %d, got %d", tt.score, score)
+			}
+		})
+	}
+}
+
+func limitPod(name string, limits ...string) *v1.Pod {
+	pod := namedPod(name)
+	for _, l := range limits {
+		c := v1.Container{}
+		if l != "" {
+			c.Resources.Limits = v1.ResourceList{v1.ResourceMemory: resource.MustParse(l)}
+		}
+		pod.Spec.Containers = append(pod.Spec.Containers, c)
+	}
+	return pod
+}
+
+func TestMemoryLimitScorer(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage string
+		pod   *v1.Pod
+		score int
+	}{
+		{"far below the limit", "500Mi", limitPod("a", "1000Mi"), 0},
+		{"at the min ratio", "900Mi", limitPod("a", "1000Mi"), 0},
+		{"halfway to the limit", "950Mi", limitPod("a", "1000Mi"), 50},
+		{"at the limit", "1000Mi", limitPod("a", "1000Mi"), 100},
+		{"above the limit", "2000Mi", limitPod("a", "1000Mi"), 100},
+		{"limits of all containers", "950Mi", limitPod("a", "500Mi", "500Mi"), 50},
+		{"container without a limit", "2000Mi", limitPod("a", "1000Mi", ""), 0},
+		{"no usage data", "", limitPod("b", "1000Mi"), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usages := map[types.NamespacedName]ResourceUsage{}
+			if tt.usage != "" {
+				usages[podKey("a")] = usage("0", tt.usage)
+			}
+			if score := NewMemoryLimitScorer(usages, 100).Score(tt.pod); score != tt.score {
+				t.Errorf("expected %d, got %d", tt.score, score)
+			}
+		})
+	}
+}
+
+func TestSpikeScorer(t *testing.T) {
+	tests := []struct {
+		name  string
+		spike UsageSpike
+		score int
+	}{
+		{"steady", UsageSpike{Recent: usage("1", "1Gi"), Baseline: usage("1", "1Gi")}, 0},
+		{"at the min ratio", UsageSpike{Recent: usage("2", "1Gi"), Baseline: usage("1", "1Gi")}, 0},
+		{"cpu spike", UsageSpike{Recent: usage("3500m", "1Gi"), Baseline: usage("1", "1Gi")}, 50},
+		{"memory spike", UsageSpike{Recent: usage("1", "5Gi"), Baseline: usage("1", "1Gi")}, 100},
+		{"bigger spike wins", UsageSpike{Recent: usage("3500m", "10Gi"), Baseline: usage("1", "1Gi")}, 100},
+		{"no baseline", UsageSpike{Recent: usage("4", "4Gi"), Baseline: usage("0", "0")}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSpikeScorer(map[types.NamespacedName]UsageSpike{podKey("a"): tt.spike}, 100)
+			if score := s.Score(namedPod("a")); score != tt.score {
+				t.Errorf("expected %d, got %d", tt.score, score)
+			}
+		})
+	}
+
+	if score := NewSpikeScorer(nil, 100).Score(namedPod("a")); score != 0 {
+		t.Errorf("pod without data scored %d", score)
+	}
+}
+
+func TestAffinityScorer(t *testing.T) {
+	nodeIn := func(key string, values ...string) v1.NodeSelectorRequirement {
+		return v1.NodeSelectorRequirement{Key: key, Operator: v1.NodeSelectorOpIn, Values: values}
+	}
+	required := func(terms ...v1.NodeSelectorTerm) *v1.Affinity {
+		return &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: terms},
+		}}
+	}
+	antiAffinity := func(key string) *v1.Affinity {
+		return &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{PodAffinityTerm: v1.PodAffinityTerm{TopologyKey: key}}},
+		}}
+	}
+
+	tests := []struct {
+		name  string
+		spec  v1.PodSpec
+		score int
+	}{
+		{"unconstrained", v1.PodSpec{}, 0},
+		{"node selector", v1.PodSpec{NodeSelector: map[string]string{hostnameLabel: "node"}}, -1000},
+		{"node selector of another node", v1.PodSpec{NodeSelector: map[string]string{hostnameLabel: "other"}}, 0},
+		{"required hostname", v1.PodSpec{Affinity: required(v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{nodeIn(hostnameLabel, "node")}})}, -1000},
+		{"required node name", v1.PodSpec{Affinity: required(v1.NodeSelectorTerm{MatchFields: []v1.NodeSelectorRequirement{nodeIn("metadata.name", "node")}})}, -1000},
+		{"several nodes allowed", v1.PodSpec{Affinity: required(v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{nodeIn(hostnameLabel, "node", "other")}})}, 0},
+		{
+			"another term allows other nodes",
+			v1.PodSpec{Affinity: required(
+				v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{nodeIn(hostnameLabel, "node")}},
+				v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{nodeIn("zone", "a")}},
+			)},
+			0,
+		},
+		{"spread by hostname", v1.PodSpec{Affinity: antiAffinity(hostnameLabel)}, 100},
+		{"spread by zone", v1.PodSpec{Affinity: antiAffinity("zone")}, 0},
+		{
+			"required spread",
+			v1.PodSpec{Affinity: &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{TopologyKey: hostnameLabel}},
+			}}},
+			100,
+		},
+		{
+			"pinned wins over spread",
+			v1.PodSpec{NodeSelector: map[string]string{hostnameLabel: "node"}, Affinity: antiAffinity(hostnameLabel)},
+			-1000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &v1.Pod{Spec: tt.spec}
+			if score := NewAffinityScorer("node").Score(pod); score != tt.score {
+				t.Errorf("expected %d, got %d", tt.score, score)
+			}
+		})
+	}
+}
+
+func TestRequestScorer(t *testing.T) {
+	cpuPod := func(name, cpu string) *v1.Pod {
+		pod := namedPod(name)
+		pod.Spec.Containers = []v1.Container{{Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu)}}}}
+		return pod
+	}
+	pods := []*v1.Pod{
+		cpuPod("big", "2"),
+		cpuPod("small", "500m"),
+		requestPod("memory", "1Gi", "1Gi"),
+		requestPod("half-memory", "1Gi"),
+		namedPod("none"),
+	}
+
+	tests := []struct {
+		resource Resource
+		pod      int
+		score    int
+	}{
+		{ResourceCPU, 0, 100},
+		{ResourceCPU, 1, 25},
+		{ResourceCPU, 2, 0},
+		{ResourceMemory, 2, 100},
+		{ResourceMemory, 3, 50},
+		{ResourceMemory, 0, 0},
+		{ResourceIO, 0, 0},
+		{ResourceCPU, 4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.resource)+"/"+pods[tt.pod].Name, func(t *testing.T) {
+			if score := NewRequestScorer(tt.resource, pods, 100).Score(pods[tt.pod]); score != tt.score {
+				t.Errorf("expected %d, got %d", tt.score, score)
+			}
+		})
+	}
+}
+
+func TestPressureScorer(t *testing.T) {
+	pressure := map[types.NamespacedName]float64{
+		podKey("culprit"): 40,
+		podKey("half"):    20,
+		podKey("calm"):    0,
+	}
+	tests := []struct {
+		name   string
+		scorer *PressureScorer
+		pod    string
+		score  int
+	}{
+		{"culprit of culprits", NewCulpritScorer(pressure, 100), "culprit", 100},
+		{"half of culprits", NewCulpritScorer(pressure, 100), "half", 50},
+		{"calm of culprits", NewCulpritScorer(pressure, 100), "calm", 0},
+		{"culprit of neighbors", NewNeighborScorer(pressure, 100), "culprit", 0},
+		{"calm of neighbors", NewNeighborScorer(pressure, 100), "calm", 100},
+		{"blend", NewPressureScorer(pressure, 100, -100), "half", 0},
+		{"no data", NewCulpritScorer(pressure, 100), "unknown", 0},
+		{"no pressure at all", NewNeighborScorer(map[types.NamespacedName]float64{podKey("calm"): 0}, 100), "calm", 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if score := tt.scorer.Score(namedPod(tt.pod)); score != tt.score {
+				t.Errorf("expected %d, got %d", tt.score, score)
+			}
+		})
+	}
+}
+
+func TestDisruptionBudgetScorer(t *testing.T) {
+	otherNamespace := budget("web", "web", 0)
+	otherNamespace.Namespace = "other"
+	noSelector := budget("none", "web", 0)
+	noSelector.Spec.Selector = nil
+
+	tests := []struct {
+		name    string
+		budgets []v1beta1.PodDisruptionBudget
+		score   int
+	}{
+		{"no budgets", nil, 0},
+		{"disruption allowed", []v1beta1.PodDisruptionBudget{budget("web", "web", 1)}, 0},
+		{"no disruption allowed", []v1beta1.PodDisruptionBudget{budget("web", "web", 0)}, Veto},
+		{"one of several budgets exhausted", []v1beta1.PodDisruptionBudget{budget("web", "web", 3), budget("also", "web", 0)}, Veto},
+		{"budget for other pods", []v1beta1.PodDisruptionBudget{budget("db", "db", 0)}, 0},
+		{"budget in another namespace", []v1beta1.PodDisruptionBudget{otherNamespace}, 0},
+		{"budget without a selector", []v1beta1.PodDisruptionBudget{noSelector}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if score := NewDisruptionBudgetScorer(tt.budgets).Score(appPod("a", "web")); score != tt.score {
+				t.Errorf("expected %d, got %d", tt.score, score)
+			}
+		})
+	}
+}
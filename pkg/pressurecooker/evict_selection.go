@@ -1,12 +1,38 @@
 package pressurecooker
 
 import (
+	"errors"
 	"math"
 	"sort"
+	"strconv"
 	"time"
 
-	"github.com/golang/glog"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// CandidateLogLevel is the verbosity the full ranking of candidates is logged
+// at, e.g. -v=2 for glog. The selected candidates are always logged.
+const CandidateLogLevel = 2
+
+// Pods annotated with ExcludeAnnotation set to "true" are never evicted,
+// pods with PreferAnnotation set to "true" are evicted first.
+const (
+	ExcludeAnnotation = "pressurecooker.rtreffer.de/exclude"
+	PreferAnnotation  = "pressurecooker.rtreffer.de/prefer"
+)
+
+// MirrorPodAnnotation is set by the kubelet on the mirror pods of static pods,
+// which can not be evicted through the API.
+const MirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+var (
+	// ErrNoPods is returned when there are no pods to choose from.
+	ErrNoPods = errors.New("no pods to evict")
+	// ErrNoSafeCandidate is returned when every pod scored below the minimum
+	// score, i.e. none of them is safe to evict.
+	ErrNoSafeCandidate = errors.New("no pod is safe to evict")
 )
 
 type PodCandidateSet []PodCandidate
@@ -15,8 +41,25 @@ func (s PodCandidateSet) Len() int {
 	return len(s)
 }
 
+// Less orders candidates by score. Equal scores are ordered by descending
+// namespace, name and UID, so the reversed order used for selection picks
+// the same pod among equally scored ones no matter how the pods were listed.
 func (s PodCandidateSet) Less(i, j int) bool {
-	return s[i].Score < s[j].Score
+	if s[i].Vetoed() != s[j].Vetoed() {
+		return s[i].Vetoed()
+	}
+	if s[i].Score != s[j].Score {
+		return s[i].Score < s[j].Score
+	}
+
+	a, b := s[i].Pod, s[j].Pod
+	if a.Namespace != b.Namespace {
+		return a.Namespace > b.Namespace
+	}
+	if a.Name != b.Name {
+		return a.Name > b.Name
+	}
+	return a.UID > b.UID
 }
 
 func (s PodCandidateSet) Swap(i, j int) {
@@ -25,9 +68,79 @@ func (s PodCandidateSet) Swap(i, j int) {
 	s[j] = x
 }
 
+// SortBy orders the candidates by first, which reports whether a ranks before
+// b, keeping the order of equal candidates.
+func (s PodCandidateSet) SortBy(first func(a, b PodCandidate) bool) {
+	sort.SliceStable(s, func(i, j int) bool {
+		return first(s[i], s[j])
+	})
+}
+
 type PodCandidate struct {
 	Pod   *v1.Pod
 	Score int
+	// Breakdown is the contribution of each scoring dimension to Score.
+	Breakdown map[string]int
+	// Vetoes are the dimensions that ruled out the eviction of the pod, see
+	// Veto. They do not contribute to Score.
+	Vetoes []string
+	// Impact estimates the relief of evicting the pod, only set if
+	// ScoringConfig.Allocatable is.
+	Impact *EvictionImpact
+}
+
+// Veto as a weight of ScoringConfig or as the score of a Scorer marks a pod as
+// never evictable, no matter how its other dimensions score, instead of
+// adding points.
+const Veto = math.MinInt32
+
+// Vetoed reports whether a dimension ruled out the eviction of the pod.
+func (c *PodCandidate) Vetoed() bool {
+	return len(c.Vetoes) > 0
+}
+
+// Scoring dimensions as reported in PodCandidate.Breakdown.
+const (
+	DimensionAge         = "age"
+	DimensionQOS         = "qos"
+	DimensionOwner       = "owner"
+	DimensionCriticality = "criticality"
+	DimensionAnnotation  = "annotation"
+	DimensionStorage     = "storage"
+	DimensionRestarts    = "restarts"
+	DimensionReadiness   = "readiness"
+	DimensionInit        = "init"
+	DimensionToleration  = "toleration"
+	DimensionMirror      = "mirror"
+	DimensionSiblings    = "siblings"
+	DimensionCustom      = "custom"
+)
+
+func (c *PodCandidate) add(dimension string, score int) {
+	if score == Veto {
+		c.Vetoes = append(c.Vetoes, dimension)
+		return
+	}
+	if c.Breakdown == nil {
+		c.Breakdown = make(map[string]int)
+	}
+	c.Score += score
+	c.Breakdown[dimension] += score
+}
+
+// Scorer adds a custom dimension to the eviction scoring. The returned value
+// is added to the builtin score, higher scores are evicted first and pods
+// with a total below ScoringConfig.MinScore are never evicted. Returning Veto
+// rules out the pod altogether.
+type Scorer interface {
+	Score(pod *v1.Pod) int
+}
+
+// ScorerFunc adapts a plain function to the Scorer interface.
+type ScorerFunc func(pod *v1.Pod) int
+
+func (f ScorerFunc) Score(pod *v1.Pod) int {
+	return f(pod)
 }
 
 func PodCandidateSetFromPodList(l *v1.PodList) PodCandidateSet {
@@ -43,98 +156,538 @@ func PodCandidateSetFromPodList(l *v1.PodList) PodCandidateSet {
 	return s
 }
 
-func (s PodCandidateSet) scoreByQOSClass() {
-	for i := range s {
-		switch s[i].Pod.Status.QOSClass {
-		case v1.PodQOSBestEffort:
-			s[i].Score += 100
-		case v1.PodQOSBurstable:
-			s[i].Score += 100
+// PodCandidateSetFromPods creates a candidate set from pods, e.g. as returned
+// by a PodLister.
+func PodCandidateSetFromPods(pods []*v1.Pod) PodCandidateSet {
+	s := make(PodCandidateSet, len(pods))
+
+	for i := range pods {
+		s[i] = PodCandidate{
+			Pod:   pods[i],
+			Score: 0,
 		}
 	}
+
+	return s
 }
 
-func (s PodCandidateSet) scoreByAge(minPodAge time.Duration) {
-	now := time.Now()
-	for i, pod := range s {
-		if pod.Pod.Status.StartTime == nil {
-			s[i].Score -= 10000
+// PodCandidateSetFromPodListOnNode only includes the pods scheduled to the
+// node, so pods of other nodes can not be evicted by accident.
+func PodCandidateSetFromPodListOnNode(l *v1.PodList, nodeName string) PodCandidateSet {
+	s := make(PodCandidateSet, 0, len(l.Items))
+
+	for i := range l.Items {
+		if l.Items[i].Spec.NodeName != nodeName {
 			continue
 		}
-		delta := now.Sub(pod.Pod.Status.StartTime.Time)
-		if delta < minPodAge {
-			s[i].Score -= 10000
+		s = append(s, PodCandidate{
+			Pod:   &l.Items[i],
+			Score: 0,
+		})
+	}
+
+	return s
+}
+
+// FilterPodsByNode returns the pods scheduled to the node.
+func FilterPodsByNode(pods []*v1.Pod, nodeName string) []*v1.Pod {
+	filtered := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if pod.Spec.NodeName == nodeName {
+			filtered = append(filtered, pod)
+		}
+	}
+	return filtered
+}
+
+// PodCandidateSetFromPodListFiltered only includes the pods matching sel.
+func PodCandidateSetFromPodListFiltered(l *v1.PodList, sel labels.Selector) PodCandidateSet {
+	s := make(PodCandidateSet, 0, len(l.Items))
+
+	for i := range l.Items {
+		if !sel.Matches(labels.Set(l.Items[i].Labels)) {
 			continue
 		}
-		age := int64(delta / time.Second)
-		if age < 1 {
-			age = 1
+		s = append(s, PodCandidate{
+			Pod:   &l.Items[i],
+			Score: 0,
+		})
+	}
+
+	return s
+}
+
+func podName(pod *v1.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
+
+// filterTerminating drops pods that are already being deleted; evicting them
+// again would not free any resources.
+func (s PodCandidateSet) filterTerminating(cfg *ScoringConfig) PodCandidateSet {
+	filtered := make(PodCandidateSet, 0, len(s))
+	for i := range s {
+		if s[i].Pod.DeletionTimestamp != nil {
+			cfg.log().Info("skipping terminating pod", "pod", podName(s[i].Pod))
+			continue
 		}
-		s[i].Score += int(math.Floor(math.Log1p(float64(age))))
+		filtered = append(filtered, s[i])
 	}
+	return filtered
 }
 
-func (s PodCandidateSet) scoreByOwnerType() {
+// filterNamespaces returns the candidates allowed by the namespace lists of
+// cfg.
+func (s PodCandidateSet) filterNamespaces(cfg *ScoringConfig) PodCandidateSet {
+	if len(cfg.Namespaces) == 0 && len(cfg.ExcludedNamespaces) == 0 {
+		return s
+	}
+
+	allowed := make(map[string]bool, len(cfg.Namespaces))
+	for _, ns := range cfg.Namespaces {
+		allowed[ns] = true
+	}
+	excluded := make(map[string]bool, len(cfg.ExcludedNamespaces))
+	for _, ns := range cfg.ExcludedNamespaces {
+		excluded[ns] = true
+	}
+
+	filtered := make(PodCandidateSet, 0, len(s))
 	for i := range s {
-		// do not evict Pods without owner; these will probably not be re-scheduled if evicted
-		if len(s[i].Pod.OwnerReferences) == 0 {
-			s[i].Score -= 1000
+		ns := s[i].Pod.Namespace
+		if excluded[ns] || (len(allowed) > 0 && !allowed[ns]) {
+			continue
 		}
+		filtered = append(filtered, s[i])
+	}
+	return filtered
+}
+
+// score computes all dimensions of a candidate in one pass, so the pod is only
+// touched once per selection even on dense nodes.
+func (c *PodCandidate) score(minPodAge time.Duration, now time.Time, cfg *ScoringConfig) {
+	// static pods are managed by the kubelet, deleting their mirror pod does
+	// not stop them; veto them independent of the enabled dimensions
+	if isMirrorPod(c.Pod) {
+		c.add(DimensionMirror, Veto)
+	}
+	if cfg.UseAge {
+		c.scoreAge(minPodAge, now, cfg)
+	}
+	if cfg.UseQOS {
+		c.scoreQOSClass(cfg)
+	}
+	if cfg.UseOwnerType {
+		c.scoreOwnerType(cfg)
+	}
+	if cfg.UseCriticality {
+		c.scoreCriticality(cfg)
+	}
+	if usesLocalStorage(c.Pod) {
+		c.add(DimensionStorage, cfg.LocalStorage)
+	}
+	// rescheduling pods with persistent volume claims may be blocked until
+	// the volume is detached from this node
+	if usesPersistentVolumeClaim(c.Pod) {
+		c.add(DimensionStorage, cfg.PersistentVolumeClaim)
+	}
+	c.scoreRestartCount(cfg)
+	// protect pods that are not ready, e.g. old pods that are currently
+	// restarting, which the age check does not cover
+	if !isPodReady(c.Pod) {
+		c.add(DimensionReadiness, cfg.NotReady)
+	}
+	// evicting pods that are still initializing discards the provisioning
+	// done so far
+	if isPodInitializing(c.Pod) {
+		c.add(DimensionInit, cfg.Initializing)
+	}
+	// pods tolerating the taint would be scheduled right back onto this node
+	if cfg.BroadToleration != 0 && toleratesPressure(c.Pod) {
+		c.add(DimensionToleration, cfg.BroadToleration)
+	}
+	if annotationIsTrue(c.Pod, ExcludeAnnotation) {
+		c.add(DimensionAnnotation, cfg.Excluded)
+	}
+	if annotationIsTrue(c.Pod, PreferAnnotation) {
+		c.add(DimensionAnnotation, cfg.Preferred)
+	}
+	for _, scorer := range cfg.Scorers {
+		c.add(DimensionCustom, scorer.Score(c.Pod))
+	}
+}
+
+func (c *PodCandidate) scoreQOSClass(cfg *ScoringConfig) {
+	switch c.Pod.Status.QOSClass {
+	case v1.PodQOSBestEffort:
+		c.add(DimensionQOS, cfg.QOSBestEffort)
+	case v1.PodQOSBurstable:
+		c.add(DimensionQOS, cfg.QOSBurstable)
+	case v1.PodQOSGuaranteed:
+		c.add(DimensionQOS, cfg.QOSGuaranteed)
+	}
+}
+
+func (c *PodCandidate) scoreAge(minPodAge time.Duration, now time.Time, cfg *ScoringConfig) {
+	if c.Pod.Status.StartTime == nil {
+		c.add(DimensionAge, cfg.NoStartTime)
+		return
+	}
+	delta := now.Sub(c.Pod.Status.StartTime.Time)
+	if delta < 0 {
+		// a start time in the future points to a skewed node clock; treat
+		// the pod as just started instead of scoring a negative age
+		cfg.log().Info("pod started in the future, check the node clock", "pod", podName(c.Pod), "ahead", -delta)
+		delta = 0
+	}
+	if delta < minPodAge {
+		c.add(DimensionAge, cfg.TooYoung)
+		return
+	}
+	age := int64(delta / time.Second)
+	if age < 1 {
+		age = 1
+	}
+	c.add(DimensionAge, int(math.Floor(math.Log1p(float64(age)))))
+}
+
+func (c *PodCandidate) scoreOwnerType(cfg *ScoringConfig) {
+	// only the controller recreates an evicted Pod, other owner references
+	// do not count; Pods without controller will probably not be
+	// re-scheduled if evicted
+	o := metav1.GetControllerOf(c.Pod)
+	if o == nil {
+		c.add(DimensionOwner, cfg.Unowned)
+		return
+	}
 
-		for j := range s[i].Pod.OwnerReferences {
-			o := &s[i].Pod.OwnerReferences[j]
+	c.scoreOwnerKind(o.Kind, cfg)
 
-			switch o.Kind {
-			case "ReplicaSet":
-				s[i].Score += 100
-			case "StatefulSet":
-				s[i].Score -= 10000
-			case "DaemonSet":
-				s[i].Score -= 10000
-			}
+	// also score the top-level controller, e.g. the CronJob of a Job
+	if top := topLevelOwner(cfg.OwnerResolver, c.Pod.Namespace, *o); top.UID != o.UID || top.Kind != o.Kind {
+		c.scoreOwnerKind(top.Kind, cfg)
+	}
+}
+
+func (c *PodCandidate) scoreOwnerKind(kind string, cfg *ScoringConfig) {
+	switch kind {
+	case "ReplicaSet":
+		c.add(DimensionOwner, cfg.ReplicaSet)
+	case "Deployment":
+		c.add(DimensionOwner, cfg.Deployment)
+	case "StatefulSet":
+		c.add(DimensionOwner, cfg.StatefulSet)
+	case "DaemonSet":
+		c.add(DimensionOwner, cfg.DaemonSet)
+	// batch work would have to start over, we want the job to finish
+	case "Job":
+		c.add(DimensionOwner, cfg.Job)
+	case "CronJob":
+		c.add(DimensionOwner, cfg.CronJob)
+	}
+}
+
+func (c *PodCandidate) scoreCriticality(cfg *ScoringConfig) {
+	if c.Pod.Namespace == "kube-system" {
+		c.add(DimensionCriticality, cfg.KubeSystem)
+	}
+
+	switch c.Pod.Spec.PriorityClassName {
+	case "system-cluster-critical":
+		c.add(DimensionCriticality, cfg.CriticalPriorityClass)
+	case "system-node-critical":
+		c.add(DimensionCriticality, cfg.CriticalPriorityClass)
+	}
+
+	if _, ok := c.Pod.Annotations["scheduler.alpha.kubernetes.io/critical-pod"]; ok {
+		c.add(DimensionCriticality, cfg.CriticalPodAnnotation)
+	}
+
+	// protect pods proportionally to their resolved priority
+	if cfg.PriorityFactor != 0 && c.Pod.Spec.Priority != nil {
+		c.add(DimensionCriticality, -int(math.Round(float64(*c.Pod.Spec.Priority)*cfg.PriorityFactor)))
+	}
+}
+
+func usesPersistentVolumeClaim(pod *v1.Pod) bool {
+	for _, vol := range pod.Spec.Volumes {
+		if vol.PersistentVolumeClaim != nil {
+			return true
 		}
 	}
+	return false
 }
 
-func (s PodCandidateSet) scoreByCriticality() {
-	for i := range s {
-		if s[i].Pod.Namespace == "kube-system" {
-			s[i].Score -= 10000
+// usesLocalStorage reports whether the pod loses data on eviction, i.e. uses a
+// disk backed emptyDir or a hostPath volume.
+func usesLocalStorage(pod *v1.Pod) bool {
+	for _, vol := range pod.Spec.Volumes {
+		if vol.EmptyDir != nil && vol.EmptyDir.Medium != v1.StorageMediumMemory {
+			return true
+		}
+		if vol.HostPath != nil {
+			return true
 		}
+	}
+	return false
+}
+
+// scoreRestartCount protects crash looping pods: these are likely the cause
+// of the pressure themselves, and evicting them moves the problem to another
+// node.
+func (c *PodCandidate) scoreRestartCount(cfg *ScoringConfig) {
+	if cfg.RestartThreshold <= 0 {
+		return
+	}
 
-		switch s[i].Pod.Spec.PriorityClassName {
-		case "system-cluster-critical":
-			s[i].Score -= 10000
-		case "system-node-critical":
-			s[i].Score -= 10000
+	restarts := int32(0)
+	for _, status := range c.Pod.Status.ContainerStatuses {
+		restarts += status.RestartCount
+	}
+	if restarts >= cfg.RestartThreshold {
+		c.add(DimensionRestarts, cfg.Restarts)
+	}
+}
+
+func toleratesPressure(pod *v1.Pod) bool {
+	for _, t := range pod.Spec.Tolerations {
+		if t.Key == "" && t.Operator == v1.TolerationOpExists {
+			return true
+		}
+		if t.Key == TaintKey && (t.Effect == "" || t.Effect == v1.TaintEffectPreferNoSchedule) {
+			return true
 		}
+	}
+	return false
+}
+
+// isMirrorPod reports whether pod mirrors a static pod, either by the
+// kubelet's annotation or by being owned by the node.
+func isMirrorPod(pod *v1.Pod) bool {
+	if _, ok := pod.Annotations[MirrorPodAnnotation]; ok {
+		return true
+	}
+	o := metav1.GetControllerOf(pod)
+	return o != nil && o.Kind == "Node"
+}
 
-		if _, ok := s[i].Pod.Annotations["scheduler.alpha.kubernetes.io/critical-pod"]; ok {
-			s[i].Score -= 10000
+func isPodInitializing(pod *v1.Pod) bool {
+	if len(pod.Status.InitContainerStatuses) < len(pod.Spec.InitContainers) {
+		return true
+	}
+	for _, c := range pod.Status.InitContainerStatuses {
+		if c.State.Terminated == nil || c.State.Terminated.ExitCode != 0 {
+			return true
 		}
 	}
+	return false
 }
 
-func (s PodCandidateSet) SelectPodForEviction(minPodAge time.Duration) *v1.Pod {
-	s.scoreByAge(minPodAge)
-	s.scoreByQOSClass()
-	s.scoreByOwnerType()
-	s.scoreByCriticality()
+func isPodReady(pod *v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
 
-	sort.Stable(sort.Reverse(s))
+func annotationIsTrue(obj metav1.Object, key string) bool {
+	v, ok := obj.GetAnnotations()[key]
+	if !ok {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	return err == nil && b
+}
+
+// SelectPodForEviction scores all candidates and returns the one with the
+// highest score of at least cfg.MinScore. A nil cfg uses DefaultScoringConfig.
+func (s PodCandidateSet) SelectPodForEviction(minPodAge time.Duration, cfg *ScoringConfig) *v1.Pod {
+	c := s.SelectCandidateForEviction(minPodAge, cfg)
+	if c == nil {
+		return nil
+	}
+	return c.Pod
+}
 
+// SelectCandidateForEviction is like SelectPodForEviction, but returns the
+// candidate including its score breakdown.
+func (s PodCandidateSet) SelectCandidateForEviction(minPodAge time.Duration, cfg *ScoringConfig) *PodCandidate {
+	candidates := s.SelectCandidatesForEviction(minPodAge, 1, cfg)
+	if len(candidates) == 0 {
+		return nil
+	}
+	return &candidates[0]
+}
+
+// FindPodForEviction is like SelectPodForEviction, but tells why no pod was
+// selected: ErrNoPods for an empty set, ErrNoSafeCandidate if no pod has a
+// score of at least cfg.MinScore.
+func (s PodCandidateSet) FindPodForEviction(minPodAge time.Duration, cfg *ScoringConfig) (*v1.Pod, error) {
+	c, err := s.FindCandidateForEviction(minPodAge, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return c.Pod, nil
+}
+
+// FindCandidateForEviction is like FindPodForEviction, but returns the
+// candidate including its score breakdown.
+func (s PodCandidateSet) FindCandidateForEviction(minPodAge time.Duration, cfg *ScoringConfig) (*PodCandidate, error) {
+	if len(s) == 0 {
+		return nil, ErrNoPods
+	}
+	c := s.SelectCandidateForEviction(minPodAge, cfg)
+	if c == nil {
+		return nil, ErrNoSafeCandidate
+	}
+	return c, nil
+}
+
+// SelectPodsForEviction returns up to n candidates with a score of at least
+// cfg.MinScore, highest score first.
+func (s PodCandidateSet) SelectPodsForEviction(minPodAge time.Duration, n int, cfg *ScoringConfig) []*v1.Pod {
+	return s.SelectCandidatesForEviction(minPodAge, n, cfg).Pods()
+}
+
+// EvaluateOnly scores all candidates and returns the full ranking, highest
+// score first, without selecting any of them. Negative scores are not
+// evictable, see Evictable. The selection methods are built on top of it, so
+// custom selection policies can use the same ranking. A zero minPodAge uses
+// cfg.MinPodAge.
+func (s PodCandidateSet) EvaluateOnly(minPodAge time.Duration, cfg *ScoringConfig) PodCandidateSet {
+	if cfg == nil {
+		cfg = DefaultScoringConfig()
+	}
+	if minPodAge == 0 {
+		minPodAge = cfg.MinPodAge
+	}
+
+	s = s.filterTerminating(cfg)
+	s = s.filterNamespaces(cfg)
+
+	now := cfg.now()
 	for i := range s {
-		glog.Infof("eviction candidate: %s/%s (score of %d)", s[i].Pod.Namespace, s[i].Pod.Name, s[i].Score)
+		s[i].score(minPodAge, now, cfg)
+		if cfg.Allocatable != nil {
+			impact := EstimateImpact(s[i].Pod, cfg.Allocatable)
+			s[i].Impact = &impact
+		}
+	}
+
+	s.rank(cfg)
+
+	for i := range s {
+		observeCandidate(&s[i], now)
+		cfg.log().V(CandidateLogLevel).Info("eviction candidate", "pod", podName(s[i].Pod), "score", s[i].Score, "breakdown", s[i].Breakdown, "vetoes", s[i].Vetoes)
+	}
+
+	return s
+}
+
+// rank sorts scored candidates by cfg.Order, by descending score if not set.
+func (s PodCandidateSet) rank(cfg *ScoringConfig) {
+	if cfg.Order != nil {
+		s.SortBy(cfg.Order)
+	} else {
+		sort.Stable(sort.Reverse(s))
+	}
+}
+
+// SelectCandidatesForEviction scores all candidates and returns up to n of
+// them with a score of at least cfg.MinScore, highest score first. Pods of a
+// controller that already has a pod in the batch are penalized by
+// cfg.SameOwner.
+func (s PodCandidateSet) SelectCandidatesForEviction(minPodAge time.Duration, n int, cfg *ScoringConfig) PodCandidateSet {
+	if cfg == nil {
+		cfg = DefaultScoringConfig()
+	}
+	return s.EvaluateOnly(minPodAge, cfg).selectTop(n, cfg)
+}
+
+// selectTop returns up to n candidates of a ranking with a score of at least
+// cfg.MinScore. Once a candidate is selected, the remaining pods of the same
+// controller are penalized by cfg.SameOwner and ranked again, so a batch does
+// not take down a whole workload at once.
+func (s PodCandidateSet) selectTop(n int, cfg *ScoringConfig) PodCandidateSet {
+	selected := s.batch(n, cfg)
+	for i := range selected {
+		selected[i].selected(cfg)
+	}
+	return selected
+}
+
+// batch is selectTop without logging and counting the selected candidates.
+func (s PodCandidateSet) batch(n int, cfg *ScoringConfig) PodCandidateSet {
+	s = s.AtLeast(cfg.minScore())
+
+	if n < 0 {
+		n = 0
 	}
 
+	selected := make(PodCandidateSet, 0, n)
+	for len(s) > 0 && len(selected) < n {
+		c := s[0]
+		s = s[1:]
+		selected = append(selected, c)
+
+		if len(selected) < n && cfg != nil && cfg.SameOwner != 0 && s.penalizeSiblings(&c, cfg.SameOwner) {
+			s.rank(cfg)
+			s = s.AtLeast(cfg.minScore())
+		}
+	}
+
+	return selected
+}
+
+// selected logs a candidate selected for eviction.
+func (c *PodCandidate) selected(cfg *ScoringConfig) {
+	cfg.log().Info("selected candidate", "pod", podName(c.Pod), "score", c.Score, "breakdown", c.Breakdown)
+}
+
+// penalizeSiblings adds penalty to the candidates with the same controller
+// as selected and reports whether there were any. The breakdown and vetoes
+// of penalized candidates are copied first, as they are shared with the
+// ranking the candidates were taken from.
+func (s PodCandidateSet) penalizeSiblings(selected *PodCandidate, penalty int) bool {
+	owner := metav1.GetControllerOf(selected.Pod)
+	if owner == nil {
+		return false
+	}
+
+	found := false
 	for i := range s {
-		if s[i].Score < 0 {
+		o := metav1.GetControllerOf(s[i].Pod)
+		if o == nil || o.UID != owner.UID || o.Kind != owner.Kind || o.Name != owner.Name || s[i].Pod.Namespace != selected.Pod.Namespace {
 			continue
 		}
 
-		glog.Infof("selected candidate: %s/%s (score of %d)", s[i].Pod.Namespace, s[i].Pod.Name, s[i].Score)
-		return s[i].Pod
+		breakdown := make(map[string]int, len(s[i].Breakdown)+1)
+		for k, v := range s[i].Breakdown {
+			breakdown[k] = v
+		}
+		s[i].Breakdown = breakdown
+		s[i].Vetoes = append([]string{}, s[i].Vetoes...)
+		s[i].add(DimensionSiblings, penalty)
+		found = true
 	}
+	return found
+}
 
-	return nil
+// Evictable returns the candidates of a ranking that are not vetoed and have
+// a non-negative score, keeping their order.
+func (s PodCandidateSet) Evictable() PodCandidateSet {
+	return s.AtLeast(0)
+}
+
+// AtLeast returns the candidates of a ranking that are not vetoed and have a
+// score of at least min, keeping their order.
+func (s PodCandidateSet) AtLeast(min int) PodCandidateSet {
+	evictable := make(PodCandidateSet, 0, len(s))
+	for i := range s {
+		if !s[i].Vetoed() && s[i].Score >= min {
+			evictable = append(evictable, s[i])
+		}
+	}
+	return evictable
 }
@@ -0,0 +1,251 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// evictablePod returns a ready pod of a ReplicaSet with the given uid that
+// started age before testNow.
+func evictablePod(name string, owner types.UID, age time.Duration) *v1.Pod {
+	pod := podStartedAgo(age)
+	pod.Name = name
+	pod.Namespace = "default"
+	controller := true
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: string(owner), UID: owner, Controller: &controller}}
+	pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	return pod
+}
+
+func testScoringConfig() *ScoringConfig {
+	cfg := DefaultScoringConfig()
+	cfg.Clock = func() time.Time { return testNow }
+	return cfg
+}
+
+func TestSelectionDoesNotCountEvictions(t *testing.T) {
+	s := PodCandidateSetFromPods([]*v1.Pod{evictablePod("a", "rs", time.Hour)})
+	counter := podsSelectedForEvictionTotal.WithLabelValues("default", "")
+	before := testutil.ToFloat64(counter)
+
+	if pods := s.SelectPodsForEviction(0, 1, testScoringConfig()); len(pods) != 1 {
+		t.Fatalf("expected a pod to be selected, got %d", len(pods))
+	}
+	if after := testutil.ToFloat64(counter); after != before {
+		t.Errorf("selecting a pod counted %f evictions", after-before)
+	}
+}
+
+func TestScoreAgeBuckets(t *testing.T) {
+	tests := []struct {
+		name   string
+		age    time.Duration
+		minAge time.Duration
+		score  int
+		veto   bool
+	}{
+		{"just started", 0, 0, 0, false},
+		{"one second", time.Second, 0, 0, false},
+		{"below e-1", 1700 * time.Millisecond, 0, 0, false},
+		{"at e-1", 2 * time.Second, 0, 1, false},
+		{"below e^2-1", 6 * time.Second, 0, 1, false},
+		{"truncated to seconds", 6900 * time.Millisecond, 0, 1, false},
+		{"at e^2-1", 7 * time.Second, 0, 2, false},
+		{"below e^3-1", 19 * time.Second, 0, 2, false},
+		{"at e^3-1", 20 * time.Second, 0, 3, false},
+		{"below e^4-1", 53 * time.Second, 0, 3, false},
+		{"at e^4-1", 54 * time.Second, 0, 4, false},
+		{"below e^5-1", 147 * time.Second, 0, 4, false},
+		{"at e^5-1", 148 * time.Second, 0, 5, false},
+		{"below e^6-1", 402 * time.Second, 0, 5, false},
+		{"at e^6-1", 403 * time.Second, 0, 6, false},
+		{"below e^7-1", 1095 * time.Second, 0, 6, false},
+		{"at e^7-1", 1096 * time.Second, 0, 7, false},
+		{"a day", 24 * time.Hour, 0, 11, false},
+		{"too young", 10*time.Minute - time.Second, 10 * time.Minute, 0, true},
+		{"at min age", 10 * time.Minute, 10 * time.Minute, 6, false},
+		{"started in the future", -time.Minute, 10 * time.Minute, 0, true},
+		{"started in the future without min age", -time.Minute, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testScoringConfig()
+			cfg.MinPodAge = tt.minAge
+			ranking := PodCandidateSetFromPods([]*v1.Pod{evictablePod("a", "rs", tt.age)}).EvaluateOnly(0, cfg)
+			c := ranking[0]
+
+			vetoed := false
+			for _, d := range c.Vetoes {
+				vetoed = vetoed || d == DimensionAge
+			}
+			if vetoed != tt.veto {
+				t.Errorf("expected veto=%t, got vetoes %v", tt.veto, c.Vetoes)
+			}
+			if score := c.Breakdown[DimensionAge]; score != tt.score {
+				t.Errorf("expected an age score of %d, got %d", tt.score, score)
+			}
+		})
+	}
+
+	ranking := PodCandidateSetFromPods([]*v1.Pod{{}}).EvaluateOnly(0, testScoringConfig())
+	if len(ranking) != 1 || len(ranking[0].Vetoes) == 0 || ranking[0].Vetoes[0] != DimensionAge {
+		t.Errorf("pod without start time was not vetoed by age: %+v", ranking)
+	}
+}
+
+type labelScorer struct{}
+
+func (labelScorer) Score(pod *v1.Pod) int {
+	if pod.Labels["tier"] == "batch" {
+		return 7
+	}
+	return 0
+}
+
+// scoringFixtures returns pods covering every builtin dimension.
+func scoringFixtures() []*v1.Pod {
+	controller := true
+	owned := func(kind string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{Kind: kind, Name: kind, UID: types.UID("uid-" + kind), Controller: &controller}}
+	}
+	started := func(age time.Duration) *metav1.Time {
+		t := metav1.NewTime(testNow.Add(-age))
+		return &t
+	}
+	ready := []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	priority := int32(1000)
+
+	return []*v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "besteffort", Namespace: "default", OwnerReferences: owned("ReplicaSet"), Labels: map[string]string{"tier": "batch"}},
+			Status:     v1.PodStatus{QOSClass: v1.PodQOSBestEffort, StartTime: started(time.Hour), Conditions: ready},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "unowned-emptydir", Namespace: "default"},
+			Spec:       v1.PodSpec{Volumes: []v1.Volume{{Name: "scratch", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}},
+			Status:     v1.PodStatus{QOSClass: v1.PodQOSBurstable, StartTime: started(48 * time.Hour), Conditions: ready},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-restarting", Namespace: "default", OwnerReferences: owned("ReplicaSet")},
+			Spec:       v1.PodSpec{Volumes: []v1.Volume{{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "data"}}}}},
+			Status: v1.PodStatus{QOSClass: v1.PodQOSGuaranteed, StartTime: started(3 * time.Hour),
+				ContainerStatuses: []v1.ContainerStatus{{Name: "app", RestartCount: 6}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "critical", Namespace: "kube-system", OwnerReferences: owned("DaemonSet"),
+				Annotations: map[string]string{"scheduler.alpha.kubernetes.io/critical-pod": ""}},
+			Spec:   v1.PodSpec{PriorityClassName: "system-node-critical"},
+			Status: v1.PodStatus{QOSClass: v1.PodQOSBurstable, StartTime: started(time.Hour), Conditions: ready},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "young", Namespace: "default", OwnerReferences: owned("ReplicaSet")},
+			Status:     v1.PodStatus{QOSClass: v1.PodQOSBurstable, StartTime: started(5 * time.Minute), Conditions: ready},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "preferred-tolerating", Namespace: "default", OwnerReferences: owned("ReplicaSet"),
+				Annotations: map[string]string{PreferAnnotation: "true"}},
+			Spec:   v1.PodSpec{Tolerations: []v1.Toleration{{Operator: v1.TolerationOpExists}}, Priority: &priority},
+			Status: v1.PodStatus{QOSClass: v1.PodQOSBurstable, StartTime: started(30 * time.Minute), Conditions: ready},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "initializing", Namespace: "default", OwnerReferences: owned("Job")},
+			Spec:       v1.PodSpec{InitContainers: []v1.Container{{Name: "init"}}},
+			Status: v1.PodStatus{QOSClass: v1.PodQOSBestEffort, StartTime: started(20 * time.Minute),
+				InitContainerStatuses: []v1.ContainerStatus{{Name: "init", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "excluded-statefulset", Namespace: "default", OwnerReferences: owned("StatefulSet"),
+				Annotations: map[string]string{ExcludeAnnotation: "true"}},
+			Status: v1.PodStatus{QOSClass: v1.PodQOSGuaranteed, StartTime: started(24 * time.Hour), Conditions: ready},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "not-started", Namespace: "default", OwnerReferences: owned("ReplicaSet")},
+			Status:     v1.PodStatus{QOSClass: v1.PodQOSBestEffort},
+		},
+	}
+}
+
+// scoringFixtureConfig enables every optional dimension and replaces the
+// vetoes by plain weights.
+func scoringFixtureConfig() *ScoringConfig {
+	cfg := DefaultScoringConfig()
+	cfg.NoStartTime = -10000
+	cfg.TooYoung = -10000
+	cfg.StatefulSet = -10000
+	cfg.DaemonSet = -10000
+	cfg.Job = -10000
+	cfg.CronJob = -10000
+	cfg.KubeSystem = -10000
+	cfg.CriticalPriorityClass = -10000
+	cfg.CriticalPodAnnotation = -10000
+	cfg.Excluded = -10000
+	cfg.Clock = func() time.Time { return testNow }
+	cfg.PriorityFactor = 0.01
+	cfg.BroadToleration = -300
+	cfg.Scorers = []Scorer{labelScorer{}}
+	return cfg
+}
+
+// TestEvaluateOnlyMatchesMultiPass compares the single pass scoring with the
+// scores and breakdowns of the former pass-per-dimension implementation.
+func TestEvaluateOnlyMatchesMultiPass(t *testing.T) {
+	expected := []struct {
+		name      string
+		score     int
+		breakdown map[string]int
+	}{
+		{"preferred-tolerating", 897, map[string]int{"age": 7, "annotation": 1000, "criticality": -10, "custom": 0, "owner": 100, "qos": 100, "toleration": -300}},
+		{"besteffort", 315, map[string]int{"age": 8, "custom": 7, "owner": 100, "qos": 200}},
+		{"unowned-emptydir", -988, map[string]int{"age": 12, "custom": 0, "owner": -1000, "qos": 100, "storage": -100}},
+		{"pvc-restarting", -1991, map[string]int{"age": 9, "custom": 0, "owner": 100, "qos": -100, "readiness": -1000, "restarts": -500, "storage": -500}},
+		{"young", -9800, map[string]int{"age": -10000, "custom": 0, "owner": 100, "qos": 100}},
+		{"not-started", -10700, map[string]int{"age": -10000, "custom": 0, "owner": 100, "qos": 200, "readiness": -1000}},
+		{"initializing", -11793, map[string]int{"age": 7, "custom": 0, "init": -1000, "owner": -10000, "qos": 200, "readiness": -1000}},
+		{"excluded-statefulset", -20089, map[string]int{"age": 11, "annotation": -10000, "custom": 0, "owner": -10000, "qos": -100}},
+		{"critical", -39892, map[string]int{"age": 8, "criticality": -30000, "custom": 0, "owner": -10000, "qos": 100}},
+	}
+
+	ranking := PodCandidateSetFromPods(scoringFixtures()).EvaluateOnly(10*time.Minute, scoringFixtureConfig())
+	if len(ranking) != len(expected) {
+		t.Fatalf("expected %d candidates, got %d", len(expected), len(ranking))
+	}
+	for i, want := range expected {
+		c := ranking[i]
+		if c.Pod.Name != want.name {
+			t.Errorf("rank %d: expected %s, got %s", i, want.name, c.Pod.Name)
+			continue
+		}
+		if c.Score != want.score || !reflect.DeepEqual(c.Breakdown, want.breakdown) {
+			t.Errorf("%s: expected %d %v, got %d %v", want.name, want.score, want.breakdown, c.Score, c.Breakdown)
+		}
+		if len(c.Vetoes) != 0 {
+			t.Errorf("%s: unexpected vetoes %v", want.name, c.Vetoes)
+		}
+	}
+}
+
+func BenchmarkEvaluateOnly(b *testing.B) {
+	fixtures := scoringFixtures()
+	for _, n := range []int{10, 100, 1000} {
+		pods := make([]*v1.Pod, n)
+		for i := range pods {
+			pods[i] = fixtures[i%len(fixtures)].DeepCopy()
+			pods[i].Name = fmt.Sprintf("%s-%d", pods[i].Name, i)
+		}
+		cfg := scoringFixtureConfig()
+
+		b.Run(fmt.Sprintf("%d candidates", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				PodCandidateSetFromPods(pods).EvaluateOnly(10*time.Minute, cfg)
+			}
+		})
+	}
+}
@@ -1,29 +1,18 @@
 package pressurecooker
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/golang/glog"
-	"github.com/prometheus/client_golang/prometheus"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/api/policy/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
-var (
-	prometheusNamespace = "pressurecooker"
-	podsEvictedTotal    = prometheus.NewGauge(prometheus.GaugeOpts{
-		Namespace: prometheusNamespace,
-		Name:      "pods_evicted_total",
-		Help:      "total number of pods evicted on this node",
-	})
-)
-
-func init() {
-	prometheus.MustRegister(podsEvictedTotal)
-}
-
 func (e *Evicter) CanEvict() bool {
 	if e.lastEviction.IsZero() {
 		return true
@@ -32,8 +21,36 @@ func (e *Evicter) CanEvict() bool {
 	return time.Now().Sub(e.lastEviction) > e.backoff
 }
 
+// evictionCapReached forgets evictions older than EvictionWindow and reports
+// whether MaxEvictions pods were evicted within the window.
+func (e *Evicter) evictionCapReached() bool {
+	if e.MaxEvictions <= 0 {
+		e.evictions = nil
+		return false
+	}
+
+	cutoff := time.Now().Add(-e.EvictionWindow)
+	recent := e.evictions[:0]
+	for _, t := range e.evictions {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	e.evictions = recent
+
+	return len(e.evictions) >= e.MaxEvictions
+}
+
+// severity is how many percentage points evt is above the eviction
+// threshold, the higher of the watcher's and the evicter's.
+func (e *Evicter) severity(evt PressureThresholdEvent) float64 {
+	return evt.Value - math.Max(evt.Threshold, e.threshold)
+}
+
 func (e *Evicter) EvictPod(evt PressureThresholdEvent) (bool, error) {
-	if evt.Avg300 < e.threshold {
+	// the watcher compared Value in its configured window, the evicter's
+	// threshold only raises the bar
+	if evt.Value < evt.Threshold || evt.Value < e.threshold {
 		return false, nil
 	}
 
@@ -42,42 +59,223 @@ func (e *Evicter) EvictPod(evt PressureThresholdEvent) (bool, error) {
 		return false, nil
 	}
 
+	if e.evictionCapReached() {
+		glog.Warningf("eviction threshold exceeded, but already evicted %d pods within %s", e.MaxEvictions, e.EvictionWindow)
+		evictionsSkippedTotal.WithLabelValues("cap_reached").Inc()
+		return false, nil
+	}
+
 	glog.Infof("searching for pod to evict")
 
-	fieldSelector := fields.OneTermEqualSelector("spec.nodeName", e.nodeName)
+	candidates, err := e.listCandidates()
+	if err != nil {
+		return false, err
+	}
 
-	podsOnNode, err := e.client.CoreV1().Pods("").List(metav1.ListOptions{
-		FieldSelector: fieldSelector.String(),
-	})
+	scoring := e.Scoring
+	if scoring == nil {
+		scoring = DefaultScoringConfig()
+	}
 
+	budgets, err := e.client.PolicyV1beta1().PodDisruptionBudgets("").List(metav1.ListOptions{})
 	if err != nil {
-		return false, err
+		glog.Errorf("could not list pod disruption budgets: %s", err.Error())
+	} else {
+		withBudgets := *scoring
+		withBudgets.Scorers = append(append([]Scorer{}, scoring.Scorers...), NewDisruptionBudgetScorer(budgets.Items))
+		scoring = &withBudgets
+	}
+
+	if e.ReplicaAware {
+		scoring = e.withReplicaScorer(scoring)
+	}
+
+	if e.RecentPodWeight != 0 {
+		minPodAge := e.minPodAge
+		if minPodAge == 0 {
+			minPodAge = scoring.MinPodAge
+		}
+		recent := NewRecentPodScorer(minPodAge, e.RecentPodWeight)
+		recent.Clock = scoring.Clock
+		if e.RecentPodDecay != nil {
+			recent.Decay = e.RecentPodDecay
+		}
+		withRecent := *scoring
+		withRecent.Scorers = append(append([]Scorer{}, scoring.Scorers...), recent)
+		scoring = &withRecent
+	}
+
+	if e.RequestWeight != 0 {
+		pods := make([]*v1.Pod, len(candidates))
+		for i := range candidates {
+			pods[i] = candidates[i].Pod
+		}
+		withRequests := *scoring
+		withRequests.Scorers = append(append([]Scorer{}, scoring.Scorers...), NewRequestScorer(evt.Resource, pods, e.RequestWeight))
+		scoring = &withRequests
 	}
 
-	candidates := PodCandidateSetFromPodList(podsOnNode)
-	podToEvict := candidates.SelectPodForEviction(e.minPodAge)
+	var selected PodCandidateSet
+	switch {
+	case e.BatchPolicy == nil:
+		var candidate *PodCandidate
+		if candidate, err = candidates.FindCandidateForEviction(e.minPodAge, scoring); err == nil {
+			selected = PodCandidateSet{*candidate}
+		}
+	case len(candidates) == 0:
+		err = ErrNoPods
+	default:
+		if selected = candidates.SelectBatchForEviction(e.minPodAge, e.severity(evt), e.BatchPolicy, scoring); len(selected) == 0 {
+			err = ErrNoSafeCandidate
+		}
+	}
 
-	if podToEvict == nil {
-		e.recorder.Eventf(e.nodeRef, v1.EventTypeWarning, "NoPodToEvict", "wanted to evict Pod, but no suitable candidate found")
+	if err == ErrNoPods || err == ErrNoSafeCandidate {
+		e.unresolved(evt)
+	}
+
+	switch err {
+	case nil:
+		e.unresolvedSince = time.Time{}
+	case ErrNoPods:
+		glog.Infof("%s pressure high, but there are no pods on the node", evt.Resource)
+		evictionsSkippedTotal.WithLabelValues("no_pods").Inc()
+		e.recorder.Eventf(e.nodeRef, v1.EventTypeWarning, "NoPodToEvict", "wanted to evict Pod, but no pods found on node")
+		return false, nil
+	case ErrNoSafeCandidate:
+		glog.Warningf("%s pressure high, but no pod is safe to evict", evt.Resource)
+		evictionsSkippedTotal.WithLabelValues("no_safe_candidate").Inc()
+		e.recorder.Eventf(e.nodeRef, v1.EventTypeWarning, "NoSafePodToEvict", "wanted to evict Pod, but no suitable candidate found")
 		return false, nil
+	default:
+		return false, err
+	}
+
+	// a batch must not exceed the remaining evictions of the cap
+	if e.MaxEvictions > 0 && len(selected) > e.MaxEvictions-len(e.evictions) {
+		selected = selected[:e.MaxEvictions-len(e.evictions)]
 	}
 
-	eviction := v1beta1.Eviction{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      podToEvict.ObjectMeta.Name,
-			Namespace: podToEvict.ObjectMeta.Namespace,
-		},
+	evicted := false
+	var firstErr error
+	for i := range selected {
+		ok, err := e.evict(evt, &selected[i])
+		evicted = evicted || ok
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return evicted, firstErr
+}
+
+// evict evicts the pod of candidate, or only logs it in a dry run.
+func (e *Evicter) evict(evt PressureThresholdEvent, candidate *PodCandidate) (bool, error) {
+	podToEvict := candidate.Pod
+	podsSelectedForEvictionTotal.WithLabelValues(podToEvict.Namespace, string(podToEvict.Status.QOSClass)).Inc()
+
+	if e.Recorder != nil {
+		e.Recorder.Eventf(podToEvict, v1.EventTypeWarning, "PressureEviction", "selected for eviction due to high %s pressure on node %s: %s eviction_threshold=%.2f score=%d dry_run=%t %v", evt.Resource, e.nodeName, evt.pressure(), e.threshold, candidate.Score, e.DryRun, candidate.Breakdown)
+	}
+
+	if e.DryRun {
+		glog.Infof("dry-run: would evict %s/%s (score of %d, %v)", podToEvict.Namespace, podToEvict.Name, candidate.Score, candidate.Breakdown)
+		e.lastEviction = time.Now()
+		e.evictions = append(e.evictions, e.lastEviction)
+		e.recordEviction(evt, candidate, nil)
+		return false, nil
 	}
 
 	podsEvictedTotal.Inc()
 
-	glog.Infof("eviction: %+v", eviction)
+	glog.Infof("eviction: %s/%s", podToEvict.Namespace, podToEvict.Name)
 
 	e.lastEviction = time.Now()
+	e.evictions = append(e.evictions, e.lastEviction)
 
-	e.recorder.Eventf(podToEvict, v1.EventTypeWarning, "EvictHighLoad", "evicting pod due to high cpu pressure on node: avg300=%.2f threshold=%.2f", evt.Avg300, e.threshold)
-	e.recorder.Eventf(e.nodeRef, v1.EventTypeWarning, "EvictHighLoad", "evicting pod due to high cpu pressure on node: avg300=%.2f threshold=%.2f", evt.Avg300, e.threshold)
+	e.recorder.Eventf(podToEvict, v1.EventTypeWarning, "EvictHighLoad", "evicting pod due to high %s pressure on node: %s eviction_threshold=%.2f score=%d %v", evt.Resource, evt.pressure(), e.threshold, candidate.Score, candidate.Breakdown)
+	e.recorder.Eventf(e.nodeRef, v1.EventTypeWarning, "EvictHighLoad", "evicting pod due to high %s pressure on node: %s eviction_threshold=%.2f", evt.Resource, evt.pressure(), e.threshold)
 
-	err = e.client.CoreV1().Pods(podToEvict.Namespace).Evict(&eviction)
+	err := Evict(context.TODO(), e.client, podToEvict, e.GracePeriod)
+	e.recordEviction(evt, candidate, err)
 	return true, err
 }
+
+// listCandidates returns the pods on this node matching PodSelector, from
+// PodLister if set, else from the API server.
+func (e *Evicter) listCandidates() (PodCandidateSet, error) {
+	selector := e.PodSelector
+	if selector == nil {
+		selector = labels.Everything()
+	}
+
+	if e.PodLister != nil {
+		pods, err := e.PodLister.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		return PodCandidateSetFromPods(FilterPodsByNode(pods, e.nodeName)), nil
+	}
+
+	fieldSelector := fields.OneTermEqualSelector("spec.nodeName", e.nodeName)
+
+	listOptions := metav1.ListOptions{
+		FieldSelector: fieldSelector.String(),
+		LabelSelector: selector.String(),
+	}
+
+	podsOnNode, err := e.client.CoreV1().Pods("").List(listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// the field selector already filters by node, this only guards against
+	// API servers ignoring it
+	return PodCandidateSetFromPodListOnNode(podsOnNode, e.nodeName), nil
+}
+
+// withReplicaScorer returns scoring extended by a ReplicaScorer, or scoring
+// itself if the workloads could not be listed.
+func (e *Evicter) withReplicaScorer(scoring *ScoringConfig) *ScoringConfig {
+	replicaSets, err := e.client.AppsV1().ReplicaSets("").List(metav1.ListOptions{})
+	if err != nil {
+		glog.Errorf("could not list replica sets: %s", err.Error())
+		return scoring
+	}
+	statefulSets, err := e.client.AppsV1().StatefulSets("").List(metav1.ListOptions{})
+	if err != nil {
+		glog.Errorf("could not list stateful sets: %s", err.Error())
+		return scoring
+	}
+
+	withReplicas := *scoring
+	withReplicas.Scorers = append(append([]Scorer{}, scoring.Scorers...), NewReplicaScorer(ReplicaCountsFromReplicaSets(replicaSets.Items, statefulSets.Items)))
+	return &withReplicas
+}
+
+// unresolved tracks evictions that found no pod to evict and cordons the node
+// once that lasted for CordonAfter.
+func (e *Evicter) unresolved(evt PressureThresholdEvent) {
+	if e.unresolvedSince.IsZero() {
+		e.unresolvedSince = time.Now()
+	}
+	if e.CordonAfter <= 0 || e.Cordoner == nil || e.cordoned || time.Since(e.unresolvedSince) < e.CordonAfter {
+		return
+	}
+
+	reason := fmt.Sprintf("%s pressure %s eviction_threshold=%.2f, but no pod could be evicted since %s", evt.Resource, evt.pressure(), e.threshold, e.unresolvedSince.Format(time.RFC3339))
+	if err := e.Cordoner.CordonNode(reason); err != nil {
+		glog.Errorf("could not cordon node: %s", err.Error())
+		return
+	}
+	e.cordoned = true
+}
+
+// Recovered ends the streak of evictions that found no pod to evict, e.g.
+// once the pressure recovered. It reports whether the evicter cordoned the
+// node during the streak, so the caller can uncordon it.
+func (e *Evicter) Recovered() bool {
+	cordoned := e.cordoned
+	e.unresolvedSince = time.Time{}
+	e.cordoned = false
+	return cordoned
+}
@@ -0,0 +1,285 @@
+package pressurecooker
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/procfs"
+	v1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	policyclient "k8s.io/client-go/kubernetes/typed/policy/v1beta1"
+	"k8s.io/client-go/tools/record"
+)
+
+// testBudgetClient only lists pod disruption budgets, all other calls panic.
+type testBudgetClient struct {
+	kubernetes.Interface
+	budgets []policyv1beta1.PodDisruptionBudget
+}
+
+func (c testBudgetClient) PolicyV1beta1() policyclient.PolicyV1beta1Interface {
+	return testPolicyClient{budgets: c.budgets}
+}
+
+type testPolicyClient struct {
+	policyclient.PolicyV1beta1Interface
+	budgets []policyv1beta1.PodDisruptionBudget
+}
+
+func (c testPolicyClient) PodDisruptionBudgets(namespace string) policyclient.PodDisruptionBudgetInterface {
+	return testBudgetList{budgets: c.budgets}
+}
+
+type testBudgetList struct {
+	policyclient.PodDisruptionBudgetInterface
+	budgets []policyv1beta1.PodDisruptionBudget
+}
+
+func (l testBudgetList) List(opts metav1.ListOptions) (*policyv1beta1.PodDisruptionBudgetList, error) {
+	return &policyv1beta1.PodDisruptionBudgetList{Items: l.budgets}, nil
+}
+
+// testPodLister lists a settable set of pods.
+type testPodLister struct {
+	mu   sync.Mutex
+	pods []*v1.Pod
+}
+
+func (l *testPodLister) set(pods ...*v1.Pod) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, pod := range pods {
+		pod.Spec.NodeName = "node"
+	}
+	l.pods = pods
+}
+
+func (l *testPodLister) List(selector labels.Selector) ([]*v1.Pod, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pods, nil
+}
+
+type testCordoner struct {
+	reasons []string
+	err     error
+}
+
+func (c *testCordoner) CordonNode(reason string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.reasons = append(c.reasons, reason)
+	return nil
+}
+
+// newTestEvicter returns a dry running evicter without back-off that lists
+// the pods of lister.
+func newTestEvicter(lister *testPodLister) *Evicter {
+	return &Evicter{
+		Scoring:   testScoringConfig(),
+		DryRun:    true,
+		PodLister: lister,
+		client:    testBudgetClient{},
+		threshold: 25,
+		nodeName:  "node",
+		nodeRef:   &v1.ObjectReference{Kind: "Node", Name: "node"},
+		recorder:  &record.FakeRecorder{},
+	}
+}
+
+var highPressure = PressureThresholdEvent{PSILine: procfs.PSILine{Avg10: 50, Avg60: 50, Avg300: 50}, Resource: ResourceCPU, State: PressureHigh, Value: 50, Threshold: 25}
+
+func TestEvictPodBelowThreshold(t *testing.T) {
+	// without a client, EvictPod panics once it looks for pods
+	e := &Evicter{threshold: 30}
+	for name, evt := range map[string]PressureThresholdEvent{
+		"below the event threshold":   {PSILine: procfs.PSILine{Avg300: 90}, Value: 20, Threshold: 25},
+		"below the evicter threshold": {PSILine: procfs.PSILine{Avg300: 90}, Value: 28, Threshold: 25},
+	} {
+		if evicted, err := e.EvictPod(evt); evicted || err != nil {
+			t.Errorf("%s: expected no eviction, got %t, %v", name, evicted, err)
+		}
+	}
+}
+
+func TestEvictionSeverity(t *testing.T) {
+	tests := []struct {
+		name      string
+		evicter   float64
+		value     float64
+		threshold float64
+		severity  float64
+	}{
+		{"at the eviction threshold", 50, 50, 25, 0},
+		{"above the eviction threshold", 50, 65, 25, 15},
+		{"watcher threshold higher", 20, 65, 25, 40},
+		{"same thresholds", 25, 30, 25, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Evicter{threshold: tt.evicter}
+			evt := PressureThresholdEvent{Value: tt.value, Threshold: tt.threshold}
+			if severity := e.severity(evt); severity != tt.severity {
+				t.Errorf("expected %f, got %f", tt.severity, severity)
+			}
+			if n := len(DefaultBatchPolicy(e.severity(evt), make(PodCandidateSet, 3))); tt.severity < 10 && n != 1 {
+				t.Errorf("expected a single pod for a marginal crossing, got %d", n)
+			}
+		})
+	}
+}
+
+func TestEvictionRecordString(t *testing.T) {
+	evt := PressureThresholdEvent{PSILine: procfs.PSILine{Avg10: 80, Avg60: 40, Avg300: 5}, Resource: ResourceMemory, Window: Window60, Value: 40, Threshold: 25}
+	r := EvictionRecord{Pod: types.NamespacedName{Namespace: "default", Name: "a"}, Score: 10, Event: evt}
+	if s := r.String(); s != "default/a (score 10, memory avg60=40.00 threshold=25.00)" {
+		t.Errorf("unexpected record %q", s)
+	}
+
+	evt.Smoothed, evt.Value = 35, 35
+	r = EvictionRecord{Pod: types.NamespacedName{Namespace: "default", Name: "a"}, Score: 10, Event: evt, DryRun: true}
+	if s := r.String(); s != "default/a (score 10, memory avg60 smoothed=35.00 threshold=25.00, dry run)" {
+		t.Errorf("unexpected record %q", s)
+	}
+}
+
+type cordonStep struct {
+	pods []*v1.Pod
+	// wait delays the eviction
+	wait time.Duration
+	// cordons is the expected number of cordons so far
+	cordons int
+}
+
+func TestCordonWhenUnresolved(t *testing.T) {
+	tests := []struct {
+		name        string
+		cordonAfter time.Duration
+		err         error
+		steps       []cordonStep
+		// recovered is whether Recovered reports a cordon afterwards
+		recovered bool
+	}{
+		{
+			name:        "no pods",
+			cordonAfter: 50 * time.Millisecond,
+			steps: []cordonStep{
+				{},
+				{wait: 60 * time.Millisecond, cordons: 1},
+				{cordons: 1},
+			},
+			recovered: true,
+		},
+		{
+			name:        "no safe candidate",
+			cordonAfter: 50 * time.Millisecond,
+			steps: []cordonStep{
+				{pods: []*v1.Pod{evictablePod("young", "rs", time.Second)}},
+				{pods: []*v1.Pod{evictablePod("young", "rs", time.Second)}, wait: 60 * time.Millisecond, cordons: 1},
+			},
+			recovered: true,
+		},
+		{
+			name:        "eviction ends the streak",
+			cordonAfter: 50 * time.Millisecond,
+			steps: []cordonStep{
+				{},
+				{pods: []*v1.Pod{evictablePod("a", "rs", time.Hour)}, wait: 60 * time.Millisecond},
+				{},
+				{wait: 60 * time.Millisecond, cordons: 1},
+			},
+			recovered: true,
+		},
+		{
+			name: "disabled",
+			steps: []cordonStep{
+				{},
+				{wait: 60 * time.Millisecond},
+			},
+		},
+		{
+			name:        "cordon failed",
+			cordonAfter: 50 * time.Millisecond,
+			err:         errors.New("conflict"),
+			steps: []cordonStep{
+				{},
+				{wait: 60 * time.Millisecond},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lister := &testPodLister{}
+			cordoner := &testCordoner{err: tt.err}
+			e := newTestEvicter(lister)
+			e.CordonAfter = tt.cordonAfter
+			e.Cordoner = cordoner
+
+			for i, step := range tt.steps {
+				time.Sleep(step.wait)
+				lister.set(step.pods...)
+				if _, err := e.EvictPod(highPressure); err != nil {
+					t.Fatalf("step %d: eviction failed: %s", i, err)
+				}
+				if len(cordoner.reasons) != step.cordons {
+					t.Fatalf("step %d: expected %d cordons, got %v", i, step.cordons, cordoner.reasons)
+				}
+			}
+			if recovered := e.Recovered(); recovered != tt.recovered {
+				t.Errorf("expected Recovered to report %t, got %t", tt.recovered, recovered)
+			}
+			if e.Recovered() {
+				t.Errorf("Recovered reported the cordon twice")
+			}
+		})
+	}
+}
+
+func TestEvictionCap(t *testing.T) {
+	batchOfThree := func(severity float64, candidates PodCandidateSet) []*v1.Pod {
+		pods := make([]*v1.Pod, 0, 3)
+		for i := 0; i < len(candidates) && i < 3; i++ {
+			pods = append(pods, candidates[i].Pod)
+		}
+		return pods
+	}
+	tests := []struct {
+		name         string
+		maxEvictions int
+		window       time.Duration
+		batch        BatchPolicy
+		events       int
+		evicted      int
+	}{
+		{"no cap", 0, time.Hour, nil, 3, 3},
+		{"capped", 2, time.Hour, nil, 3, 2},
+		{"window passed", 2, time.Nanosecond, nil, 3, 3},
+		{"capped batch", 2, time.Hour, batchOfThree, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lister := &testPodLister{}
+			lister.set(evictablePod("a", "a", time.Hour), evictablePod("b", "b", time.Hour), evictablePod("c", "c", time.Hour))
+			e := newTestEvicter(lister)
+			e.MaxEvictions = tt.maxEvictions
+			e.EvictionWindow = tt.window
+			e.BatchPolicy = tt.batch
+
+			for i := 0; i < tt.events; i++ {
+				if _, err := e.EvictPod(highPressure); err != nil {
+					t.Fatalf("eviction %d failed: %s", i, err)
+				}
+			}
+			if records := e.DrainEvictions(); len(records) != tt.evicted {
+				t.Errorf("expected %d evictions, got %v", tt.evicted, records)
+			}
+		})
+	}
+}
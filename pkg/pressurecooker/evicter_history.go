@@ -0,0 +1,91 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DefaultEvictionHistory is the number of eviction decisions kept if
+// Evicter.HistorySize is zero.
+const DefaultEvictionHistory = 100
+
+// EvictionRecord is an eviction decision of the evicter, including dry runs.
+type EvictionRecord struct {
+	Pod       types.NamespacedName
+	Score     int
+	Breakdown map[string]int
+	// Event is the pressure that triggered the eviction.
+	Event  PressureThresholdEvent
+	DryRun bool
+	// Err is the error returned by the eviction API, nil on success.
+	Err  error
+	Time time.Time
+}
+
+func (r EvictionRecord) String() string {
+	s := fmt.Sprintf("%s (score %d, %s %s", r.Pod, r.Score, r.Event.Resource, r.Event.pressure())
+	if r.DryRun {
+		s += ", dry run"
+	}
+	if r.Err != nil {
+		s += ", failed: " + r.Err.Error()
+	}
+	return s + ")"
+}
+
+// recordEviction adds a decision to the history, dropping the oldest one
+// once HistorySize is reached.
+func (e *Evicter) recordEviction(evt PressureThresholdEvent, c *PodCandidate, err error) {
+	size := e.HistorySize
+	if size <= 0 {
+		size = DefaultEvictionHistory
+	}
+
+	e.historyMu.Lock()
+	defer e.historyMu.Unlock()
+
+	e.history = append(e.history, EvictionRecord{
+		Pod:       types.NamespacedName{Namespace: c.Pod.Namespace, Name: c.Pod.Name},
+		Score:     c.Score,
+		Breakdown: c.Breakdown,
+		Event:     evt,
+		DryRun:    e.DryRun,
+		Err:       err,
+		Time:      time.Now(),
+	})
+	if len(e.history) > size {
+		e.history = append([]EvictionRecord{}, e.history[len(e.history)-size:]...)
+	}
+}
+
+// DrainEvictions returns the recorded eviction decisions, oldest first, and
+// clears the history.
+func (e *Evicter) DrainEvictions() []EvictionRecord {
+	e.historyMu.Lock()
+	defer e.historyMu.Unlock()
+
+	drained := e.history
+	e.history = nil
+	return drained
+}
+
+// RecordEvictionSummary drains the history and records it as a single
+// EvictionSummary event on the node, e.g. once an hour for capacity
+// planning. Nothing is recorded if no pod was evicted since the last call.
+func (e *Evicter) RecordEvictionSummary(window time.Duration) []EvictionRecord {
+	records := e.DrainEvictions()
+	if len(records) == 0 {
+		return records
+	}
+
+	entries := make([]string, len(records))
+	for i, r := range records {
+		entries[i] = r.String()
+	}
+	e.recorder.Eventf(e.nodeRef, v1.EventTypeNormal, "EvictionSummary", "%d eviction decisions within %s: %s", len(records), window, strings.Join(entries, ", "))
+	return records
+}
@@ -0,0 +1,76 @@
+package pressurecooker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEvictionHistory(t *testing.T) {
+	tests := []struct {
+		name        string
+		historySize int
+		pods        []string
+		history     []string
+	}{
+		{"empty", 0, nil, nil},
+		{"keeps the order", 0, []string{"a", "b"}, []string{"a", "b"}},
+		{"drops the oldest", 2, []string{"a", "b", "c"}, []string{"b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lister := &testPodLister{}
+			e := newTestEvicter(lister)
+			e.HistorySize = tt.historySize
+			for _, name := range tt.pods {
+				lister.set(evictablePod(name, "rs", time.Hour))
+				if _, err := e.EvictPod(highPressure); err != nil {
+					t.Fatalf("eviction of %s failed: %s", name, err)
+				}
+			}
+
+			records := e.DrainEvictions()
+			if len(records) != len(tt.history) {
+				t.Fatalf("expected %v, got %v", tt.history, records)
+			}
+			for i, r := range records {
+				if r.Pod.Name != tt.history[i] || !r.DryRun || r.Event.Resource != ResourceCPU || r.Err != nil {
+					t.Errorf("expected a dry run of %s, got %s", tt.history[i], r)
+				}
+			}
+			if records := e.DrainEvictions(); len(records) != 0 {
+				t.Errorf("history was not cleared, got %v", records)
+			}
+		})
+	}
+}
+
+func TestRecordEvictionSummary(t *testing.T) {
+	lister := &testPodLister{}
+	e := newTestEvicter(lister)
+	recorder := record.NewFakeRecorder(10)
+	e.recorder = recorder
+
+	if records := e.RecordEvictionSummary(time.Hour); len(records) != 0 || len(recorder.Events) != 0 {
+		t.Fatalf("recorded a summary without evictions: %v", records)
+	}
+
+	lister.set(evictablePod("a", "rs", time.Hour))
+	if _, err := e.EvictPod(highPressure); err != nil {
+		t.Fatalf("eviction failed: %s", err)
+	}
+	if records := e.RecordEvictionSummary(time.Hour); len(records) != 1 {
+		t.Fatalf("expected a single record, got %v", records)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, v1.EventTypeNormal+" EvictionSummary 1 eviction decisions within 1h0m0s: default/a") {
+			t.Errorf("unexpected summary %q", event)
+		}
+	default:
+		t.Errorf("no summary was recorded")
+	}
+}
@@ -1,10 +1,12 @@
 package pressurecooker
 
 import (
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -12,7 +14,59 @@ import (
 	"k8s.io/client-go/tools/record"
 )
 
+// PodLister lists pods, it is satisfied by the listers of client-go
+// informers.
+type PodLister interface {
+	List(selector labels.Selector) ([]*v1.Pod, error)
+}
+
 type Evicter struct {
+	// Scoring configures the selection of the pod to evict, nil uses
+	// DefaultScoringConfig.
+	Scoring *ScoringConfig
+	// DryRun only logs the pod that would be evicted.
+	DryRun bool
+	// PodSelector restricts eviction to pods matching the selector.
+	PodSelector labels.Selector
+	// PodLister optionally lists the pods from a cache, e.g. an informer's
+	// lister, instead of querying the API server on every eviction.
+	PodLister PodLister
+	// GracePeriod overrides the termination grace period of evicted pods in
+	// seconds, nil uses the pod's own. Zero or less evicts immediately.
+	GracePeriod *int64
+	// BatchPolicy optionally evicts several pods per event depending on how
+	// far the pressure is above the eviction threshold, see BatchPolicy. Nil
+	// evicts a single pod per event.
+	BatchPolicy BatchPolicy
+	// MaxEvictions caps the number of pods evicted within EvictionWindow,
+	// zero means no cap. This guards against evicting a large part of the
+	// node before the pressure responds.
+	MaxEvictions   int
+	EvictionWindow time.Duration
+	// RequestWeight prefers pods with big requests of the resource under
+	// pressure, see RequestScorer. Zero disables it.
+	RequestWeight int
+	// RecentPodWeight is added to pods that just passed the minimum pod age,
+	// decaying by RecentPodDecay until they are twice as old, see
+	// RecentPodScorer. It is usually negative, zero disables it.
+	RecentPodWeight int
+	RecentPodDecay  AgeDecay
+	// ReplicaAware penalizes evicting the last ready replicas of ReplicaSets
+	// and StatefulSets, see ReplicaScorer. This lists both on every eviction.
+	ReplicaAware bool
+	// Recorder optionally receives a PressureEviction event on every pod
+	// selected for eviction, including dry runs, in addition to the events
+	// recorded by the evicter itself.
+	Recorder record.EventRecorder
+	// CordonAfter cordons the node through Cordoner once no pod could be
+	// evicted for that long while the pressure stayed above the threshold,
+	// so the scheduler stops adding pods. Zero disables it.
+	CordonAfter time.Duration
+	Cordoner    Cordoner
+	// HistorySize is the number of eviction decisions kept for
+	// DrainEvictions, DefaultEvictionHistory if zero.
+	HistorySize int
+
 	client       kubernetes.Interface
 	threshold    float64
 	nodeName     string
@@ -21,6 +75,15 @@ type Evicter struct {
 	minPodAge    time.Duration
 	backoff      time.Duration
 	lastEviction time.Time
+	// evictions are the times of the evictions within EvictionWindow
+	evictions []time.Time
+	// unresolvedSince is when the current streak of evictions that found no
+	// pod to evict started, zero if there is none
+	unresolvedSince time.Time
+	cordoned        bool
+
+	historyMu sync.Mutex
+	history   []EvictionRecord
 }
 
 func NewEvicter(client kubernetes.Interface, threshold float64, nodeName string, backoff string, minPodAge string) (*Evicter, error) {
@@ -33,9 +96,12 @@ func NewEvicter(client kubernetes.Interface, threshold float64, nodeName string,
 		return nil, err
 	}
 
-	minPodAgeDuration, err := time.ParseDuration(minPodAge)
-	if err != nil {
-		return nil, err
+	// an empty minimum pod age leaves it to ScoringConfig.MinPodAge
+	var minPodAgeDuration time.Duration
+	if minPodAge != "" {
+		if minPodAgeDuration, err = time.ParseDuration(minPodAge); err != nil {
+			return nil, err
+		}
 	}
 
 	b := record.NewBroadcaster()
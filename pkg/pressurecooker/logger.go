@@ -0,0 +1,78 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/glog"
+)
+
+// glogLogger is the logr.Logger used when no logger is configured. It writes
+// the key/value pairs as key=value after the message.
+type glogLogger struct {
+	name   string
+	values []interface{}
+	level  int
+}
+
+var defaultLogger logr.Logger = glogLogger{}
+
+// loggerOr returns l, or the glog backed default logger if l is nil.
+func loggerOr(l logr.Logger) logr.Logger {
+	if l == nil {
+		return defaultLogger
+	}
+	return l
+}
+
+func (l glogLogger) Enabled() bool {
+	return bool(glog.V(glog.Level(l.level)))
+}
+
+func (l glogLogger) Info(msg string, keysAndValues ...interface{}) {
+	if l.Enabled() {
+		glog.InfoDepth(1, l.format(msg, keysAndValues))
+	}
+}
+
+func (l glogLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	glog.ErrorDepth(1, l.format(msg, append([]interface{}{"error", err}, keysAndValues...)))
+}
+
+func (l glogLogger) V(level int) logr.InfoLogger {
+	l.level += level
+	return l
+}
+
+func (l glogLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	l.values = append(append([]interface{}{}, l.values...), keysAndValues...)
+	return l
+}
+
+func (l glogLogger) WithName(name string) logr.Logger {
+	if l.name != "" {
+		name = l.name + "/" + name
+	}
+	l.name = name
+	return l
+}
+
+func (l glogLogger) format(msg string, keysAndValues []interface{}) string {
+	var b strings.Builder
+	if l.name != "" {
+		b.WriteString(l.name)
+		b.WriteString(": ")
+	}
+	b.WriteString(msg)
+
+	kv := append(append([]interface{}{}, l.values...), keysAndValues...)
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 < len(kv) {
+			fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", kv[i])
+		}
+	}
+	return b.String()
+}
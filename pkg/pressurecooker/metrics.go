@@ -0,0 +1,114 @@
+package pressurecooker
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+var (
+	prometheusNamespace = "pressurecooker"
+	podsEvictedTotal    = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: prometheusNamespace,
+		Name:      "pods_evicted_total",
+		Help:      "total number of pods evicted on this node",
+	})
+	pressureAverage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: prometheusNamespace,
+		Name:      "pressure_average",
+		Help:      "current pressure stall average in percent",
+	}, []string{"resource", "stall", "window"})
+	pressureStallSecondsTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: prometheusNamespace,
+		Name:      "pressure_stall_seconds_total",
+		Help:      "total time tasks were stalled since boot",
+	}, []string{"resource", "stall"})
+	thresholdCrossingsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: prometheusNamespace,
+		Name:      "pressure_threshold_crossings_total",
+		Help:      "number of times a resource crossed the pressure threshold",
+	}, []string{"resource", "cgroup", "direction"})
+	pressureStuck = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: prometheusNamespace,
+		Name:      "pressure_stuck",
+		Help:      "pressure stayed high for longer than the stuck-after duration (1) or not (0)",
+	}, []string{"resource", "cgroup"})
+	podsSelectedForEvictionTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: prometheusNamespace,
+		Name:      "pods_selected_for_eviction_total",
+		Help:      "number of pods the evicter acted on, including dry runs",
+	}, []string{"namespace", "qos_class"})
+	candidatePodAgeSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: prometheusNamespace,
+		Name:      "candidate_pod_age_seconds",
+		Help:      "age of the pods considered for eviction",
+		Buckets:   prometheus.ExponentialBuckets(60, 2, 12),
+	})
+	candidateScore = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: prometheusNamespace,
+		Name:      "candidate_score",
+		Help:      "eviction score of the pods considered for eviction, vetoed pods excluded",
+		Buckets:   []float64{-1000, -500, -100, 0, 100, 200, 300, 500, 1000, 2000},
+	})
+	readFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: prometheusNamespace,
+		Name:      "pressure_read_failures_total",
+		Help:      "number of failed or empty pressure reads, including retried ones",
+	}, []string{"resource"})
+	stallFallbacksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: prometheusNamespace,
+		Name:      "pressure_stall_fallbacks_total",
+		Help:      "number of reads that used the some pressure as full pressure was configured but not reported",
+	}, []string{"resource"})
+	nodeEnabled = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: prometheusNamespace,
+		Name:      "enabled",
+		Help:      "pressurecooker is enabled (1) or disabled (0) on the node, see DisableAnnotation",
+	})
+	evictionsSkippedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: prometheusNamespace,
+		Name:      "evictions_skipped_total",
+		Help:      "number of times an eviction was wanted but no pod could be evicted",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(podsEvictedTotal)
+	prometheus.MustRegister(pressureAverage)
+	prometheus.MustRegister(pressureStallSecondsTotal)
+	prometheus.MustRegister(thresholdCrossingsTotal)
+	prometheus.MustRegister(pressureStuck)
+	prometheus.MustRegister(podsSelectedForEvictionTotal)
+	prometheus.MustRegister(candidatePodAgeSeconds)
+	prometheus.MustRegister(candidateScore)
+	prometheus.MustRegister(evictionsSkippedTotal)
+	prometheus.MustRegister(readFailuresTotal)
+	prometheus.MustRegister(stallFallbacksTotal)
+	prometheus.MustRegister(nodeEnabled)
+	nodeEnabled.Set(1)
+}
+
+func observeCandidate(c *PodCandidate, now time.Time) {
+	if start := c.Pod.Status.StartTime; start != nil {
+		candidatePodAgeSeconds.Observe(now.Sub(start.Time).Seconds())
+	}
+	if !c.Vetoed() {
+		candidateScore.Observe(float64(c.Score))
+	}
+}
+
+func observePressure(r Resource, stats procfs.PSIStats) {
+	observePressureLine(r, StallSome, stats.Some)
+	observePressureLine(r, StallFull, stats.Full)
+}
+
+func observePressureLine(r Resource, stall StallType, l *procfs.PSILine) {
+	if l == nil {
+		return
+	}
+	pressureAverage.WithLabelValues(r.String(), stall.String(), Window10.String()).Set(l.Avg10)
+	pressureAverage.WithLabelValues(r.String(), stall.String(), Window60.String()).Set(l.Avg60)
+	pressureAverage.WithLabelValues(r.String(), stall.String(), Window300.String()).Set(l.Avg300)
+	pressureStallSecondsTotal.WithLabelValues(r.String(), stall.String()).Set(stallTime(l).Seconds())
+}
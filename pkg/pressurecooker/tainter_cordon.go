@@ -0,0 +1,70 @@
+package pressurecooker
+
+import (
+	"github.com/golang/glog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CordonAnnotation marks nodes cordoned by pressurecooker, so only these are
+// uncordoned again.
+const CordonAnnotation = "pressurecooker.rtreffer.de/cordoned"
+
+// Cordoner cordons the node when the pressure can not be resolved by
+// evictions, see Evicter.CordonAfter.
+type Cordoner interface {
+	CordonNode(reason string) error
+}
+
+// CordonNode marks the node unschedulable. Nodes that are already cordoned
+// are left alone and are not uncordoned by UncordonNode.
+func (t *Tainter) CordonNode(reason string) error {
+	node, err := t.client.CoreV1().Nodes().Get(t.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if node.Spec.Unschedulable {
+		glog.Infof("wanted to cordon node %s, but it is already cordoned", node.Name)
+		return nil
+	}
+
+	nodeCopy := node.DeepCopy()
+	nodeCopy.Spec.Unschedulable = true
+	if nodeCopy.Annotations == nil {
+		nodeCopy.Annotations = make(map[string]string, 1)
+	}
+	nodeCopy.Annotations[CordonAnnotation] = "true"
+
+	if _, err := t.client.CoreV1().Nodes().Update(nodeCopy); err != nil {
+		t.recorder.Eventf(t.nodeRef, v1.EventTypeWarning, "NodePatchError", "could not cordon node: %s", err.Error())
+		return err
+	}
+
+	t.recorder.Eventf(t.nodeRef, v1.EventTypeWarning, "PressureCordon", "cordoning node: %s", reason)
+	return nil
+}
+
+// UncordonNode reverts CordonNode. Nodes cordoned by others are left alone.
+func (t *Tainter) UncordonNode() error {
+	node, err := t.client.CoreV1().Nodes().Get(t.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if !annotationIsTrue(node, CordonAnnotation) {
+		return nil
+	}
+
+	nodeCopy := node.DeepCopy()
+	nodeCopy.Spec.Unschedulable = false
+	delete(nodeCopy.Annotations, CordonAnnotation)
+
+	if _, err := t.client.CoreV1().Nodes().Update(nodeCopy); err != nil {
+		t.recorder.Eventf(t.nodeRef, v1.EventTypeWarning, "NodePatchError", "could not uncordon node: %s", err.Error())
+		return err
+	}
+
+	t.recorder.Eventf(t.nodeRef, v1.EventTypeNormal, "PressureUncordon", "pressure recovered, uncordoning node")
+	return nil
+}
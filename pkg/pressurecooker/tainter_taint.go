@@ -31,16 +31,7 @@ func (t *Tainter) IsPressurecookerDisabled() (bool, error) {
 		return false, err
 	}
 
-	for k, v := range node.Labels {
-		if k != "pressurecooker.enabled" {
-			continue
-		}
-		if v == "FALSE" || v == "false" {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return IsNodeDisabled(node), nil
 }
 
 func (t *Tainter) TaintNode(evt PressureThresholdEvent) error {
@@ -70,7 +61,7 @@ func (t *Tainter) TaintNode(evt PressureThresholdEvent) error {
 
 	_, err = t.client.CoreV1().Nodes().Update(nodeCopy)
 
-	t.recorder.Eventf(t.nodeRef, v1.EventTypeWarning, "CPUPressureExceeded", "pressure over 5 minutes on node was %.2f, tainting node", evt.Avg300)
+	t.recorder.Eventf(t.nodeRef, v1.EventTypeWarning, evt.Resource.title()+"PressureExceeded", "%s pressure on node was %s, tainting node", evt.Resource, evt.pressure())
 
 	if err != nil {
 		t.recorder.Eventf(t.nodeRef, v1.EventTypeWarning, "NodePatchError", "could not patch node: %s", err.Error())
@@ -100,7 +91,11 @@ func (t *Tainter) UntaintNode(evt PressureThresholdEvent) error {
 		return nil
 	}
 
-	t.recorder.Eventf(t.nodeRef, v1.EventTypeNormal, "LoadThresholdDeceeded", "pressure on node was %.2f over 5 minutes. untainting node", evt.Avg300)
+	if evt.State == PressurePaused {
+		t.recorder.Eventf(t.nodeRef, v1.EventTypeNormal, "PressurecookerDisabled", "pressurecooker disabled on node, untainting node")
+	} else {
+		t.recorder.Eventf(t.nodeRef, v1.EventTypeNormal, "LoadThresholdDeceeded", "%s pressure on node was %s, untainting node", evt.Resource, evt.pressure())
+	}
 
 	_, err = t.client.CoreV1().Nodes().Patch(t.nodeName, types.JSONPatchType, jsonpatch.PatchList{{
 		Op:    "test",
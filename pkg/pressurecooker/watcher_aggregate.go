@@ -0,0 +1,145 @@
+package pressurecooker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Aggregation combines the state of the node-wide resources. With "any" the
+// node is high as soon as one resource is high, with "all" only while every
+// watched resource is high at once. The watcher then sends combined events
+// instead of one per resource: the event of the resource with the highest
+// pressure among the high ones, listing them in HighResources. Rising and
+// stuck events are still sent per resource, cgroups are not aggregated.
+type Aggregation string
+
+const (
+	AggregateAny Aggregation = "any"
+	AggregateAll Aggregation = "all"
+)
+
+func (a Aggregation) String() string {
+	return string(a)
+}
+
+func ParseAggregation(s string) (Aggregation, error) {
+	switch a := Aggregation(strings.ToLower(strings.TrimSpace(s))); a {
+	case AggregateAny, AggregateAll:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown aggregation %q, expected any or all", s)
+}
+
+// combine returns the combined state of high out of total resources.
+func (a Aggregation) combine(high, total int) bool {
+	if a == AggregateAll {
+		return total > 0 && high == total
+	}
+	return high > 0
+}
+
+// tickAggregated reads and evaluates all node-wide resources and sends the
+// combined event. It returns false if ctx was cancelled while delivering the
+// results.
+func (w *Watcher) tickAggregated(ctx context.Context, exceeded, deceeded chan<- PressureThresholdEvent, errs chan<- error) bool {
+	events := make([]PressureThresholdEvent, 0, len(w.Resources))
+	paused := false
+	for _, r := range w.Resources {
+		evt, err := w.read(ctx, r)
+		if err != nil {
+			return sendError(ctx, errs, err)
+		}
+		paused = w.paused(evt) || paused
+		events = append(events, evt)
+	}
+	if len(events) == 0 {
+		return true
+	}
+
+	type delivery struct {
+		c   chan<- PressureThresholdEvent
+		evt PressureThresholdEvent
+	}
+	deliveries := make([]delivery, 0, len(events)+1)
+
+	w.mu.Lock()
+	if paused && !w.aggregatedHigh {
+		w.mu.Unlock()
+		return true
+	}
+	var high []Resource
+	isHigh := make([]bool, len(events))
+	representative := 0
+	fire := false
+	for i := range events {
+		k := stateKey{resource: events[i].Resource}
+		c := w.transition(k, &events[i], exceeded, deceeded)
+		switch events[i].State {
+		case PressureRising, PressureStuck:
+			if c != nil {
+				deliveries = append(deliveries, delivery{c, events[i]})
+			}
+		case PressureExceeded, PressureHigh:
+			fire = fire || c != nil
+		}
+
+		isHigh[i] = w.stateFor(k).isCurrentlyHigh
+		if isHigh[i] {
+			high = append(high, events[i].Resource)
+		}
+		if w.preferRepresentative(events[i], isHigh[i], events[representative], isHigh[representative]) {
+			representative = i
+		}
+	}
+
+	combined := w.Aggregation.combine(len(high), len(events))
+	evt := events[representative]
+	evt.HighResources = high
+
+	var c chan<- PressureThresholdEvent
+	switch {
+	case combined && !w.aggregatedHigh:
+		evt.State = PressureExceeded
+		c = exceeded
+	case combined && fire:
+		evt.State = PressureHigh
+		c = exceeded
+	case !combined && w.aggregatedHigh:
+		evt.State = PressureRecovered
+		c = deceeded
+	case !combined:
+		evt.State = PressureNormal
+		c = deceeded
+	}
+	if c != nil {
+		w.log().Info("combined state", "aggregation", w.Aggregation, "state", evt.State, "high", high)
+	}
+	w.aggregatedHigh = combined
+	w.mu.Unlock()
+
+	// a paused watcher still lets the node recover
+	if paused {
+		deliveries = deliveries[:0]
+		if evt.State != PressureRecovered {
+			return true
+		}
+	}
+	deliveries = append(deliveries, delivery{c, evt})
+	for _, d := range deliveries {
+		if !w.deliver(ctx, d.c, d.evt) {
+			return false
+		}
+	}
+	return true
+}
+
+// preferRepresentative reports whether evt rather than current represents a
+// combined event: high resources first, then the highest window average.
+func (w *Watcher) preferRepresentative(evt PressureThresholdEvent, evtHigh bool, current PressureThresholdEvent, currentHigh bool) bool {
+	if evtHigh != currentHigh {
+		return evtHigh
+	}
+	window := w.window()
+	return window.average(&evt.PSILine) > window.average(&current.PSILine)
+}
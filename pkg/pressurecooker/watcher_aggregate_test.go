@@ -0,0 +1,119 @@
+package pressurecooker
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/procfs"
+)
+
+type aggregateStep struct {
+	cpu, memory float64
+	// state is the expected combined state, empty if no event is expected
+	state PressureState
+	// resource is the representative of the combined event
+	resource Resource
+	high     []Resource
+}
+
+func TestAggregation(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   WatcherConfig
+		steps []aggregateStep
+	}{
+		{
+			name: "any",
+			cfg:  WatcherConfig{Aggregation: AggregateAny, PressureThreshold: 25},
+			steps: []aggregateStep{
+				{cpu: 10, memory: 10, state: PressureNormal, resource: ResourceCPU},
+				{cpu: 10, memory: 30, state: PressureExceeded, resource: ResourceMemory, high: []Resource{ResourceMemory}},
+				{cpu: 40, memory: 30, state: PressureHigh, resource: ResourceCPU, high: []Resource{ResourceCPU, ResourceMemory}},
+				{cpu: 40, memory: 10, state: PressureHigh, resource: ResourceCPU, high: []Resource{ResourceCPU}},
+				{cpu: 10, memory: 10, state: PressureRecovered, resource: ResourceCPU},
+			},
+		},
+		{
+			name: "all",
+			cfg:  WatcherConfig{Aggregation: AggregateAll, PressureThreshold: 25},
+			steps: []aggregateStep{
+				{cpu: 30, memory: 10, state: PressureNormal, resource: ResourceCPU, high: []Resource{ResourceCPU}},
+				{cpu: 30, memory: 40, state: PressureExceeded, resource: ResourceMemory, high: []Resource{ResourceCPU, ResourceMemory}},
+				{cpu: 30, memory: 40, state: PressureHigh, resource: ResourceMemory, high: []Resource{ResourceCPU, ResourceMemory}},
+				{cpu: 10, memory: 40, state: PressureRecovered, resource: ResourceMemory, high: []Resource{ResourceMemory}},
+				{cpu: 10, memory: 10, state: PressureNormal, resource: ResourceCPU},
+			},
+		},
+		{
+			name: "shared minimum eviction interval",
+			cfg:  WatcherConfig{Aggregation: AggregateAny, PressureThreshold: 25, MinEvictionInterval: time.Hour},
+			steps: []aggregateStep{
+				{cpu: 30, memory: 10, state: PressureExceeded, resource: ResourceCPU, high: []Resource{ResourceCPU}},
+				// memory is held back by the interval cpu started
+				{cpu: 30, memory: 40},
+				{cpu: 10, memory: 10, state: PressureRecovered, resource: ResourceCPU},
+				{cpu: 10, memory: 40, state: PressureNormal, resource: ResourceMemory},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			pressure := map[string]float64{}
+			reader := PSIReaderFunc(func(resource string) (procfs.PSIStats, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				line := procfs.PSILine{Avg10: pressure[resource], Avg60: pressure[resource], Avg300: pressure[resource]}
+				return procfs.PSIStats{Some: &line, Full: &line}, nil
+			})
+			tt.cfg.Resources = []Resource{ResourceCPU, ResourceMemory}
+			w := newTestWatcher(t, tt.cfg, reader)
+
+			for i, step := range tt.steps {
+				mu.Lock()
+				pressure["cpu"], pressure["memory"] = step.cpu, step.memory
+				mu.Unlock()
+
+				events, err := w.Tick(context.Background())
+				if err != nil {
+					t.Fatalf("step %d: tick failed: %s", i, err)
+				}
+				var state PressureState
+				if len(events) > 0 {
+					state = events[0].State
+				}
+				if len(events) > 1 || state != step.state {
+					t.Fatalf("step %d: expected state %q at cpu=%.0f memory=%.0f, got %+v", i, step.state, step.cpu, step.memory, events)
+				}
+				if len(events) == 0 {
+					continue
+				}
+				if events[0].Resource != step.resource || !reflect.DeepEqual(events[0].HighResources, step.high) {
+					t.Errorf("step %d: expected %s representing %v, got %s representing %v", i, step.resource, step.high, events[0].Resource, events[0].HighResources)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAggregation(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Aggregation
+		err  bool
+	}{
+		{in: "any", want: AggregateAny},
+		{in: " ALL ", want: AggregateAll},
+		{in: "", err: true},
+		{in: "most", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAggregation(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseAggregation(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package pressurecooker
+
+import "math"
+
+// DefaultBaselineSamples is the number of reads the adaptive baseline is
+// learnt from if Watcher.BaselineSamples is zero, an hour at the default
+// ticker interval.
+const DefaultBaselineSamples = 240
+
+// minBaselineDeviation is the lowest standard deviation the adaptive
+// threshold is computed with, so a node with a flat pressure does not fire on
+// tiny changes.
+const minBaselineDeviation = 1.0
+
+// baseline is a rolling window of the usual pressure of a resource.
+type baseline struct {
+	samples []float64
+	next    int
+}
+
+func (b *baseline) add(v float64, size int) {
+	if len(b.samples) < size {
+		b.samples = append(b.samples, v)
+		return
+	}
+	b.samples[b.next] = v
+	b.next = (b.next + 1) % len(b.samples)
+}
+
+// stats returns the mean and standard deviation of the samples.
+func (b *baseline) stats() (mean, stddev float64) {
+	if len(b.samples) == 0 {
+		return 0, 0
+	}
+	for _, v := range b.samples {
+		mean += v
+	}
+	mean /= float64(len(b.samples))
+	for _, v := range b.samples {
+		stddev += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(stddev / float64(len(b.samples)))
+}
+
+func (w *Watcher) baselineSamples() int {
+	if w.BaselineSamples <= 0 {
+		return DefaultBaselineSamples
+	}
+	return w.BaselineSamples
+}
+
+// thresholds returns the high and low threshold of a resource in state. With
+// BaselineDeviations set, the high threshold is the baseline plus that many
+// standard deviations once a quarter of BaselineSamples was learnt; the low
+// threshold is as far above the baseline as the ratio of LowThreshold to the
+// absolute threshold. The caller must hold w.mu.
+func (w *Watcher) thresholds(state *resourceState, r Resource) (float64, float64) {
+	high, low := w.threshold(r), w.lowThreshold(r)
+	if !w.adaptive(state) {
+		return high, low
+	}
+
+	mean, stddev := state.baseline.stats()
+	deviation := w.BaselineDeviations * math.Max(stddev, minBaselineDeviation)
+	return math.Min(mean+deviation, 100), math.Min(mean+deviation*low/high, 100)
+}
+
+func (w *Watcher) adaptive(state *resourceState) bool {
+	return w.BaselineDeviations > 0 && len(state.baseline.samples) >= w.baselineSamples()/4
+}
+
+// learn adds the pressure of a read to the baseline. Once the adaptive
+// threshold applies, reads above it are outliers and not learnt. The caller
+// must hold w.mu.
+func (w *Watcher) learn(state *resourceState, average, threshold float64) {
+	if w.BaselineDeviations <= 0 || (w.adaptive(state) && average >= threshold) {
+		return
+	}
+	state.baseline.add(average, w.baselineSamples())
+}
@@ -0,0 +1,85 @@
+package pressurecooker
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBaselineStats(t *testing.T) {
+	var b baseline
+	for _, v := range []float64{1, 2, 3, 10, 10, 10} {
+		b.add(v, 3)
+	}
+	mean, stddev := b.stats()
+	if len(b.samples) != 3 || mean != 10 || stddev != 0 {
+		t.Errorf("expected the last 3 samples with mean 10, got %v (mean=%f stddev=%f)", b.samples, mean, stddev)
+	}
+
+	b = baseline{}
+	for _, v := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		b.add(v, 8)
+	}
+	if mean, stddev := b.stats(); mean != 5 || stddev != 2 {
+		t.Errorf("expected mean=5 stddev=2, got mean=%f stddev=%f", mean, stddev)
+	}
+}
+
+func tickState(t *testing.T, w *Watcher) (PressureThresholdEvent, bool) {
+	t.Helper()
+	events, err := w.Tick(context.Background())
+	if err != nil {
+		t.Fatalf("tick failed: %s", err)
+	}
+	if len(events) == 0 {
+		return PressureThresholdEvent{}, false
+	}
+	return events[len(events)-1], true
+}
+
+func TestBaselineThreshold(t *testing.T) {
+	pressure := &testPressure{pressure: 50}
+	w := newTestWatcher(t, WatcherConfig{
+		PressureThreshold:  25,
+		LowThreshold:       20,
+		BaselineDeviations: 3,
+		BaselineSamples:    4,
+	}, pressure)
+
+	// the absolute threshold applies until the baseline was learnt
+	if evt, ok := tickState(t, w); !ok || evt.State != PressureExceeded || evt.Threshold != 25 {
+		t.Fatalf("expected the absolute threshold to be exceeded, got %+v", evt)
+	}
+
+	// a flat baseline of 50 uses the minimal deviation: 50 + 3*1
+	if evt, ok := tickState(t, w); !ok || evt.State != PressureRecovered || evt.Threshold != 53 {
+		t.Fatalf("expected a recovery below the adaptive threshold, got %+v", evt)
+	}
+	for i := 0; i < 3; i++ {
+		if evt, ok := tickState(t, w); !ok || evt.State != PressureNormal {
+			t.Fatalf("expected the usual pressure to be normal, got %+v", evt)
+		}
+	}
+
+	pressure.set(60)
+	evt, ok := tickState(t, w)
+	if !ok || evt.State != PressureExceeded || evt.Threshold != 53 {
+		t.Fatalf("expected a spike above the baseline to exceed it, got %+v", evt)
+	}
+	if mean, _ := w.state[stateKey{resource: ResourceCPU}].baseline.stats(); mean != 50 {
+		t.Errorf("spike was learnt, baseline mean is %f", mean)
+	}
+}
+
+func TestBaselineDisabled(t *testing.T) {
+	w := newTestWatcher(t, WatcherConfig{PressureThreshold: 25}, &testPressure{pressure: 50})
+
+	if evt, ok := tickState(t, w); !ok || evt.State != PressureExceeded {
+		t.Fatalf("expected the absolute threshold to be exceeded, got %+v", evt)
+	}
+	if evt, ok := tickState(t, w); ok && evt.State != PressureHigh {
+		t.Fatalf("expected the pressure to stay high, got %+v", evt)
+	}
+	if len(w.state[stateKey{resource: ResourceCPU}].baseline.samples) != 0 {
+		t.Errorf("baseline learnt while disabled")
+	}
+}
@@ -0,0 +1,37 @@
+package pressurecooker
+
+import (
+	"fmt"
+)
+
+// OnThresholdCrossed registers fn to be called whenever a watched resource
+// crosses a threshold, i.e. for every event of state PressureExceeded,
+// PressureRecovered, PressureStuck or PressurePaused. Callbacks run synchronously in the loop
+// started by Run, in the order they were registered; a panicking callback is
+// logged and does not stop the loop or the other callbacks.
+func (w *Watcher) OnThresholdCrossed(fn func(PressureThresholdEvent)) {
+	w.callbacksMu.Lock()
+	defer w.callbacksMu.Unlock()
+
+	w.callbacks = append(w.callbacks, fn)
+}
+
+func (w *Watcher) notifyThresholdCrossed(evt PressureThresholdEvent) {
+	w.callbacksMu.Lock()
+	callbacks := w.callbacks
+	w.callbacksMu.Unlock()
+
+	for _, fn := range callbacks {
+		w.runCallback(fn, evt)
+	}
+}
+
+func (w *Watcher) runCallback(fn func(PressureThresholdEvent), evt PressureThresholdEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.log().Error(fmt.Errorf("%v", r), "threshold callback panicked", "resource", evt.source(), "state", evt.State)
+		}
+	}()
+
+	fn(evt)
+}
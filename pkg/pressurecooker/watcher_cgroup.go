@@ -0,0 +1,178 @@
+package pressurecooker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/procfs"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DefaultCgroupRoot is where the cgroup v2 hierarchy is usually mounted.
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// Cgroup is a cgroup watched under a name, e.g. {"system", "system.slice"}.
+type Cgroup struct {
+	Name string
+	// Path is absolute or relative to Watcher.CgroupRoot.
+	Path string
+}
+
+// ParseCgroups parses a comma separated list of name=path pairs, e.g.
+// "pods=kubepods.slice,system=system.slice".
+func ParseCgroups(list string) ([]Cgroup, error) {
+	cgroups := make([]Cgroup, 0)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid cgroup %q, expected name=path", item)
+		}
+		cgroups = append(cgroups, Cgroup{Name: parts[0], Path: parts[1]})
+	}
+	return cgroups, nil
+}
+
+// ReadCgroup reads the pressure of resource r for a single cgroup from its
+// <resource>.pressure file (kernel 4.20+ with cgroup v2). Relative paths are
+// resolved against CgroupRoot, e.g. "kubepods.slice". The State of the
+// returned event is PressureHigh if the cgroup is above the threshold of r,
+// no state is tracked between calls.
+func (w *Watcher) ReadCgroup(ctx context.Context, path string, r Resource) (PressureThresholdEvent, error) {
+	path = w.cgroupPath(path)
+	file := filepath.Join(path, r.String()+".pressure")
+
+	stats, err := w.readStats(ctx, r, func() (procfs.PSIStats, error) {
+		return readPSIStatsFile(file)
+	})
+	if err != nil {
+		return PressureThresholdEvent{}, err
+	}
+
+	line, stall := w.pressureLine(r, stats)
+	if line == nil {
+		return PressureThresholdEvent{}, fmt.Errorf("could not load %s %s pressure of cgroup %s, got %v", r, w.StallType, path, stats)
+	}
+
+	evt := w.event(line, stall, r)
+	evt.Cgroup = path
+	if evt.Value >= evt.Threshold {
+		evt.State = PressureHigh
+	}
+
+	return evt, nil
+}
+
+// CurrentCgroup reads the pressure of all watched resources of a cgroup, see
+// ReadCgroup.
+func (w *Watcher) CurrentCgroup(ctx context.Context, path string) ([]PressureThresholdEvent, error) {
+	events := make([]PressureThresholdEvent, 0, len(w.Resources))
+	for _, r := range w.Resources {
+		evt, err := w.ReadCgroup(ctx, path, r)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, evt)
+	}
+	return events, nil
+}
+
+// PodCgroup returns the cgroup of a pod relative to CgroupRoot as created by
+// the kubelet, e.g. kubepods.slice/kubepods-burstable.slice/
+// kubepods-burstable-pod<uid>.slice with the systemd cgroup driver or
+// kubepods/burstable/pod<uid> with the cgroupfs driver. It returns an empty
+// path for pods without QoS class.
+func PodCgroup(pod *v1.Pod, systemd bool) string {
+	uid := string(pod.UID)
+	qos := strings.ToLower(string(pod.Status.QOSClass))
+	switch {
+	case qos == "":
+		return ""
+	case systemd && pod.Status.QOSClass == v1.PodQOSGuaranteed:
+		return "kubepods.slice/kubepods-pod" + strings.Replace(uid, "-", "_", -1) + ".slice"
+	case systemd:
+		return fmt.Sprintf("kubepods.slice/kubepods-%s.slice/kubepods-%s-pod%s.slice", qos, qos, strings.Replace(uid, "-", "_", -1))
+	case pod.Status.QOSClass == v1.PodQOSGuaranteed:
+		return "kubepods/pod" + uid
+	default:
+		return "kubepods/" + qos + "/pod" + uid
+	}
+}
+
+// PodPressure reads the pressure of resource r of every pod's cgroup, see
+// PodCgroup, e.g. for a PressureScorer. Pods whose cgroup can not be read are
+// left out.
+func (w *Watcher) PodPressure(ctx context.Context, pods []*v1.Pod, r Resource, systemd bool) map[types.NamespacedName]float64 {
+	pressure := make(map[types.NamespacedName]float64, len(pods))
+	for _, pod := range pods {
+		path := PodCgroup(pod, systemd)
+		if path == "" {
+			continue
+		}
+		evt, err := w.ReadCgroup(ctx, path, r)
+		if err != nil {
+			w.log().Info("could not read the pressure of a pod", "pod", podName(pod), "cgroup", path, "error", err.Error())
+			continue
+		}
+		pressure[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}] = evt.Value
+	}
+	return pressure
+}
+
+func (w *Watcher) cgroupPath(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	root := w.CgroupRoot
+	if root == "" {
+		root = DefaultCgroupRoot
+	}
+	return filepath.Join(root, path)
+}
+
+func readPSIStatsFile(file string) (procfs.PSIStats, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return procfs.PSIStats{}, err
+	}
+	return ParsePSIStats(strings.NewReader(string(data)))
+}
+
+// ParsePSIStats parses the content of a pressure file. The format of the
+// cgroup files is the same as /proc/pressure, but procfs only exposes a
+// parser for the latter.
+func ParsePSIStats(r io.Reader) (procfs.PSIStats, error) {
+	stats := procfs.PSIStats{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		l := scanner.Text()
+		prefix := strings.Split(l, " ")[0]
+		if prefix != "some" && prefix != "full" {
+			continue
+		}
+
+		psi := procfs.PSILine{}
+		_, err := fmt.Sscanf(l, prefix+" avg10=%f avg60=%f avg300=%f total=%d", &psi.Avg10, &psi.Avg60, &psi.Avg300, &psi.Total)
+		if err != nil {
+			return procfs.PSIStats{}, fmt.Errorf("could not parse pressure line %q: %s", l, err.Error())
+		}
+
+		if prefix == "some" {
+			stats.Some = &psi
+		} else {
+			stats.Full = &psi
+		}
+	}
+
+	return stats, scanner.Err()
+}
@@ -0,0 +1,293 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/procfs"
+)
+
+// WatcherConfig configures a Watcher. Zero fields get the defaults noted
+// below, see the Watcher fields of the same name for their meaning.
+type WatcherConfig struct {
+	// ProcPath defaults to /proc.
+	ProcPath string
+	// PSIReader replaces the procfs mounted at ProcPath, e.g. to feed
+	// synthetic pressure into the watcher.
+	PSIReader PSIReader
+	// Resources defaults to cpu.
+	Resources []Resource
+
+	// PressureThreshold defaults to 25.
+	PressureThreshold float64
+	// LowThreshold defaults to PressureThreshold, if set it must be below
+	// PressureThreshold and all Thresholds.
+	LowThreshold float64
+	Thresholds   map[Resource]float64
+	// Window defaults to avg60.
+	Window Window
+	// StallType defaults to some.
+	StallType StallType
+
+	// TickerInterval defaults to 15s.
+	TickerInterval time.Duration
+	Jitter         float64
+	// ReadTimeout defaults to 5s.
+	ReadTimeout time.Duration
+	ReadRetries int
+	// Logger defaults to glog.
+	Logger logr.Logger
+	// CgroupRoot defaults to /sys/fs/cgroup.
+	CgroupRoot  string
+	Cgroups     []Cgroup
+	Aggregation Aggregation
+	// MemoryPressureLevel falls back to the cgroup v1 memory.pressure_level
+	// notifications of MemoryCgroupV1 (DefaultMemoryCgroupV1 if empty) if the
+	// kernel has no /proc/pressure, see MemoryPressureLevelReader. Only
+	// memory can be watched then: Resources default to memory and other
+	// resources are an error. It is ignored if PSIReader is set.
+	MemoryPressureLevel bool
+	MemoryCgroupV1      string
+	// Node enables DisableAnnotation checks.
+	Node NodeAccessor
+
+	SustainedFor        time.Duration
+	MinEvictionInterval time.Duration
+	RiseRate            float64
+	Smoothing           float64
+	BaselineDeviations  float64
+	BaselineSamples     int
+	Warmup              time.Duration
+	StuckAfter          time.Duration
+}
+
+func (cfg *WatcherConfig) setDefaults() {
+	if cfg.ProcPath == "" {
+		cfg.ProcPath = procfs.DefaultMountPoint
+	}
+	if len(cfg.Resources) == 0 {
+		cfg.Resources = []Resource{ResourceCPU}
+	}
+	if cfg.PressureThreshold == 0 {
+		cfg.PressureThreshold = 25
+	}
+	if cfg.Window == 0 {
+		cfg.Window = DefaultWindow
+	}
+	if cfg.StallType == "" {
+		cfg.StallType = StallSome
+	}
+	if cfg.TickerInterval == 0 {
+		cfg.TickerInterval = 15 * time.Second
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = 5 * time.Second
+	}
+	if cfg.CgroupRoot == "" {
+		cfg.CgroupRoot = DefaultCgroupRoot
+	}
+}
+
+// Validate checks the configuration for invalid or contradicting values.
+// Zero values are valid, they are replaced by the defaults.
+func (cfg *WatcherConfig) Validate() error {
+	for _, r := range cfg.Resources {
+		if _, err := ParseResource(string(r)); err != nil {
+			return err
+		}
+	}
+
+	if err := validThreshold("pressure threshold", cfg.PressureThreshold); err != nil {
+		return err
+	}
+	if cfg.LowThreshold < 0 || cfg.LowThreshold > 100 {
+		return fmt.Errorf("low threshold must be between 0 and 100, got %f", cfg.LowThreshold)
+	}
+	for r, t := range cfg.Thresholds {
+		if _, err := ParseResource(string(r)); err != nil {
+			return err
+		}
+		if err := validThreshold(r.String()+" pressure threshold", t); err != nil {
+			return err
+		}
+		if t == 0 {
+			return fmt.Errorf("%s pressure threshold must be positive, got %f", r, t)
+		}
+	}
+	// a set low threshold has to be below the thresholds in effect, i.e.
+	// after the defaults were applied
+	if cfg.LowThreshold > 0 {
+		defaulted := *cfg
+		defaulted.setDefaults()
+		if cfg.LowThreshold >= defaulted.PressureThreshold {
+			return fmt.Errorf("low threshold %f must be below the pressure threshold %f", cfg.LowThreshold, defaulted.PressureThreshold)
+		}
+		for r, t := range cfg.Thresholds {
+			if cfg.LowThreshold >= t {
+				return fmt.Errorf("low threshold %f must be below the %s pressure threshold %f", cfg.LowThreshold, r, t)
+			}
+		}
+	}
+
+	if cfg.Window != 0 && !cfg.Window.valid() {
+		return fmt.Errorf("unknown pressure window %d, expected one of 10, 60 or 300", int(cfg.Window))
+	}
+	if cfg.StallType != "" {
+		if _, err := ParseStallType(string(cfg.StallType)); err != nil {
+			return err
+		}
+	}
+	if cfg.Aggregation != "" {
+		if _, err := ParseAggregation(string(cfg.Aggregation)); err != nil {
+			return err
+		}
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"ticker interval", cfg.TickerInterval},
+		{"read timeout", cfg.ReadTimeout},
+		{"sustained-for duration", cfg.SustainedFor},
+		{"minimum eviction interval", cfg.MinEvictionInterval},
+		{"warmup", cfg.Warmup},
+		{"stuck-after duration", cfg.StuckAfter},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", d.name, d.value)
+		}
+	}
+	if cfg.RiseRate < 0 {
+		return fmt.Errorf("rise rate must not be negative, got %f", cfg.RiseRate)
+	}
+	if cfg.BaselineDeviations < 0 {
+		return fmt.Errorf("baseline deviations must not be negative, got %f", cfg.BaselineDeviations)
+	}
+	if cfg.BaselineSamples < 0 {
+		return fmt.Errorf("baseline samples must not be negative, got %d", cfg.BaselineSamples)
+	}
+	if cfg.ReadRetries < 0 {
+		return fmt.Errorf("read retries must not be negative, got %d", cfg.ReadRetries)
+	}
+	if cfg.Jitter < 0 || cfg.Jitter >= 1 {
+		return fmt.Errorf("jitter must be at least 0 and below 1, got %f", cfg.Jitter)
+	}
+	if cfg.Smoothing < 0 || cfg.Smoothing > 1 {
+		return fmt.Errorf("smoothing must be between 0 and 1, got %f", cfg.Smoothing)
+	}
+
+	names := make(map[string]bool, len(cfg.Cgroups))
+	for _, cg := range cfg.Cgroups {
+		if cg.Name == "" || cg.Path == "" {
+			return fmt.Errorf("cgroup %q needs a name and a path", cg.Name+"="+cg.Path)
+		}
+		if names[cg.Name] {
+			return fmt.Errorf("cgroup %q registered twice", cg.Name)
+		}
+		names[cg.Name] = true
+	}
+
+	return nil
+}
+
+func validThreshold(name string, t float64) error {
+	if t < 0 || t > 100 {
+		return fmt.Errorf("%s must be between 0 and 100, got %f", name, t)
+	}
+	return nil
+}
+
+func NewWatcherFromConfig(cfg WatcherConfig) (*Watcher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	defaultResources := len(cfg.Resources) == 0
+	cfg.setDefaults()
+
+	watched := make([]Resource, 0, len(cfg.Resources))
+	seen := make(map[Resource]bool, len(cfg.Resources))
+	for _, r := range cfg.Resources {
+		if !seen[r] {
+			seen[r] = true
+			watched = append(watched, r)
+		}
+	}
+
+	thresholds := make(map[Resource]float64, len(cfg.Thresholds))
+	for r, t := range cfg.Thresholds {
+		thresholds[r] = t
+	}
+
+	reader := cfg.PSIReader
+	var closer io.Closer
+	if reader == nil {
+		fs, err := procfs.NewFS(cfg.ProcPath)
+		if err != nil {
+			return nil, err
+		}
+		reader = fs
+
+		if _, err := reader.PSIStatsForResource(watched[0].String()); err != nil && cfg.MemoryPressureLevel {
+			loggerOr(cfg.Logger).Info("pressure stall information is not available, falling back to memory.pressure_level", "error", err)
+			if defaultResources {
+				watched = []Resource{ResourceMemory}
+			}
+			for _, r := range watched {
+				if r != ResourceMemory {
+					return nil, fmt.Errorf("pressure stall information is not available and memory.pressure_level only reports memory pressure, can not watch %s: %s", r, err.Error())
+				}
+			}
+			pressureLevel, err := NewMemoryPressureLevelReader(cfg.MemoryCgroupV1)
+			if err != nil {
+				return nil, err
+			}
+			reader, closer = pressureLevel, pressureLevel
+		}
+	}
+
+	// fail early if the kernel does not report one of the resources, e.g. io
+	// on kernels without CONFIG_PSI or when booted with psi=0
+	for _, r := range watched {
+		stats, err := reader.PSIStatsForResource(r.String())
+		if err != nil {
+			return nil, fmt.Errorf("%s pressure is not available: %s", r, err.Error())
+		}
+		// most kernels report no "full" line for cpu
+		if cfg.StallType == StallFull && stats.Full == nil {
+			loggerOr(cfg.Logger).Info("kernel reports no full pressure, falling back to some", "resource", r)
+		}
+	}
+
+	return &Watcher{
+		PressureThreshold:   cfg.PressureThreshold,
+		LowThreshold:        cfg.LowThreshold,
+		Thresholds:          thresholds,
+		TickerInterval:      cfg.TickerInterval,
+		Jitter:              cfg.Jitter,
+		ReadTimeout:         cfg.ReadTimeout,
+		ReadRetries:         cfg.ReadRetries,
+		CgroupRoot:          cfg.CgroupRoot,
+		Logger:              cfg.Logger,
+		Cgroups:             append([]Cgroup{}, cfg.Cgroups...),
+		Resources:           watched,
+		Window:              cfg.Window,
+		StallType:           cfg.StallType,
+		SustainedFor:        cfg.SustainedFor,
+		MinEvictionInterval: cfg.MinEvictionInterval,
+		RiseRate:            cfg.RiseRate,
+		Smoothing:           cfg.Smoothing,
+		BaselineDeviations:  cfg.BaselineDeviations,
+		BaselineSamples:     cfg.BaselineSamples,
+		Warmup:              cfg.Warmup,
+		StuckAfter:          cfg.StuckAfter,
+		Node:                cfg.Node,
+		Aggregation:         cfg.Aggregation,
+		proc:                reader,
+		closer:              closer,
+		state:               make(map[stateKey]*resourceState, len(watched)*(len(cfg.Cgroups)+1)),
+	}, nil
+}
@@ -0,0 +1,72 @@
+package pressurecooker
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateThresholds(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   WatcherConfig
+		valid bool
+	}{
+		{"defaults", WatcherConfig{}, true},
+		{"low below threshold", WatcherConfig{PressureThreshold: 40, LowThreshold: 30}, true},
+		{"low equal to threshold", WatcherConfig{PressureThreshold: 40, LowThreshold: 40}, false},
+		{"low above threshold", WatcherConfig{PressureThreshold: 40, LowThreshold: 50}, false},
+		{"low below default threshold", WatcherConfig{LowThreshold: 20}, true},
+		{"low equal to default threshold", WatcherConfig{LowThreshold: 25}, false},
+		{"low above default threshold", WatcherConfig{LowThreshold: 30}, false},
+		{
+			"low below resource threshold",
+			WatcherConfig{PressureThreshold: 40, LowThreshold: 30, Thresholds: map[Resource]float64{ResourceMemory: 35}},
+			true,
+		},
+		{
+			"low equal to resource threshold",
+			WatcherConfig{PressureThreshold: 40, LowThreshold: 30, Thresholds: map[Resource]float64{ResourceMemory: 30}},
+			false,
+		},
+		{
+			"low above resource threshold",
+			WatcherConfig{PressureThreshold: 40, LowThreshold: 30, Thresholds: map[Resource]float64{ResourceIO: 20}},
+			false,
+		},
+		{"resource threshold without low", WatcherConfig{Thresholds: map[Resource]float64{ResourceIO: 5}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestMemoryPressureLevelResources(t *testing.T) {
+	// neither /proc/pressure nor memory.pressure_level exist
+	dir, err := ioutil.TempDir("", "pressurecooker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := WatcherConfig{ProcPath: dir, MemoryPressureLevel: true, MemoryCgroupV1: dir}
+
+	_, err = NewWatcherFromConfig(cfg)
+	if err == nil || strings.Contains(err.Error(), "can not watch") {
+		t.Errorf("expected the default resources to fall back to memory, got %v", err)
+	}
+
+	cfg.Resources = []Resource{ResourceMemory, ResourceCPU}
+	_, err = NewWatcherFromConfig(cfg)
+	if err == nil || !strings.Contains(err.Error(), "can not watch cpu") {
+		t.Errorf("expected watching cpu to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package pressurecooker
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// pressureThresholdEventJSON is the stable JSON representation of a
+// PressureThresholdEvent; procfs.PSILine has no JSON tags of its own.
+type pressureThresholdEventJSON struct {
+	Resource   Resource      `json:"resource"`
+	Cgroup     string        `json:"cgroup,omitempty"`
+	CgroupName string        `json:"cgroupName,omitempty"`
+	State      PressureState `json:"state"`
+	Timestamp  time.Time     `json:"timestamp"`
+	Avg10      float64       `json:"avg10"`
+	Avg60      float64       `json:"avg60"`
+	Avg300     float64       `json:"avg300"`
+	Total      uint64        `json:"total"`
+	Rate       float64       `json:"rate"`
+	StallType  StallType     `json:"stallType,omitempty"`
+	Window     Window        `json:"window,omitempty"`
+	Smoothed   float64       `json:"smoothed,omitempty"`
+	Value      float64       `json:"value"`
+	Threshold  float64       `json:"threshold"`
+	High       []Resource    `json:"highResources,omitempty"`
+}
+
+func (e PressureThresholdEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pressureThresholdEventJSON{
+		Resource:   e.Resource,
+		Cgroup:     e.Cgroup,
+		CgroupName: e.CgroupName,
+		State:      e.State,
+		Timestamp:  e.Timestamp,
+		Avg10:      e.Avg10,
+		Avg60:      e.Avg60,
+		Avg300:     e.Avg300,
+		Total:      e.Total,
+		Rate:       e.Rate,
+		StallType:  e.StallType,
+		Window:     e.Window,
+		Smoothed:   e.Smoothed,
+		Value:      e.Value,
+		Threshold:  e.Threshold,
+		High:       e.HighResources,
+	})
+}
+
+func (e *PressureThresholdEvent) UnmarshalJSON(data []byte) error {
+	var j pressureThresholdEventJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*e = PressureThresholdEvent{
+		Resource:      j.Resource,
+		Cgroup:        j.Cgroup,
+		CgroupName:    j.CgroupName,
+		State:         j.State,
+		Timestamp:     j.Timestamp,
+		Rate:          j.Rate,
+		StallType:     j.StallType,
+		Window:        j.Window,
+		Smoothed:      j.Smoothed,
+		Value:         j.Value,
+		Threshold:     j.Threshold,
+		HighResources: j.High,
+	}
+	e.Avg10 = j.Avg10
+	e.Avg60 = j.Avg60
+	e.Avg300 = j.Avg300
+	e.Total = j.Total
+	return nil
+}
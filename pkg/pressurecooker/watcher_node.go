@@ -0,0 +1,139 @@
+package pressurecooker
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DisableAnnotation set to "true" on the node disables pressurecooker on it,
+// e.g. during maintenance. The watcher pauses: the pressure is still read and
+// logged, resources that were high are released with a PressurePaused event
+// and no new exceedance is reported until the annotation is removed.
+const DisableAnnotation = "pressurecooker.rtreffer.de/disable"
+
+// EnabledLabel set to "false" disables pressurecooker like DisableAnnotation.
+// It predates the annotation and is still honored.
+const EnabledLabel = "pressurecooker.enabled"
+
+// nodeRefreshInterval is how often the watcher reads the node for
+// DisableAnnotation.
+const nodeRefreshInterval = time.Minute
+
+// NodeAccessor returns the node the watcher runs on, e.g. from an informer's
+// lister.
+type NodeAccessor func() (*v1.Node, error)
+
+// NewNodeAccessor returns a NodeAccessor getting the node from the API server.
+func NewNodeAccessor(client kubernetes.Interface, nodeName string) NodeAccessor {
+	return func() (*v1.Node, error) {
+		return client.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	}
+}
+
+// IsNodeDisabled reports whether pressurecooker is disabled on node through
+// DisableAnnotation or EnabledLabel.
+func IsNodeDisabled(node *v1.Node) bool {
+	if annotationIsTrue(node, DisableAnnotation) {
+		return true
+	}
+	v := node.Labels[EnabledLabel]
+	return v == "FALSE" || v == "false"
+}
+
+// updateDisabled checks the node for DisableAnnotation, at most once per
+// nodeRefreshInterval. The previous state is kept if the node can not be
+// read. Once the node turns disabled, every high resource and cgroup is
+// released and a PressurePaused event sent on deceeded. It returns false if
+// ctx was cancelled while delivering them.
+func (w *Watcher) updateDisabled(ctx context.Context, deceeded chan<- PressureThresholdEvent) bool {
+	if w.Node == nil {
+		return true
+	}
+
+	w.mu.Lock()
+	due := time.Since(w.nodeCheckedAt) >= nodeRefreshInterval
+	if due {
+		w.nodeCheckedAt = time.Now()
+	}
+	w.mu.Unlock()
+	if !due {
+		return true
+	}
+
+	node, err := w.Node()
+	if err != nil {
+		w.log().Error(err, "could not check node for the disable annotation")
+		return true
+	}
+	disabled := IsNodeDisabled(node)
+	if disabled {
+		nodeEnabled.Set(0)
+	} else {
+		nodeEnabled.Set(1)
+	}
+
+	w.mu.Lock()
+	changed := disabled != w.disabled
+	w.disabled = disabled
+	var released []PressureThresholdEvent
+	if changed && disabled {
+		released = w.release()
+	}
+	w.mu.Unlock()
+
+	if changed {
+		w.log().Info("node disable state changed", "annotation", DisableAnnotation, "disabled", disabled)
+	}
+	for _, evt := range released {
+		if !w.deliver(ctx, deceeded, evt) {
+			return false
+		}
+	}
+	return true
+}
+
+// release forgets that any resource or cgroup is high and returns a
+// PressurePaused event for each of them, valued by the last read. The caller
+// must hold w.mu.
+func (w *Watcher) release() []PressureThresholdEvent {
+	keys := make([]stateKey, 0, len(w.Resources)*(len(w.Cgroups)+1))
+	for _, r := range w.Resources {
+		keys = append(keys, stateKey{resource: r})
+	}
+	for _, cg := range w.Cgroups {
+		for _, r := range w.Resources {
+			keys = append(keys, stateKey{cgroup: cg.Name, resource: r})
+		}
+	}
+
+	var released []PressureThresholdEvent
+	for _, k := range keys {
+		s, ok := w.state[k]
+		if !ok || !s.isCurrentlyHigh {
+			continue
+		}
+		if s.stuck {
+			pressureStuck.WithLabelValues(k.resource.String(), k.cgroup).Set(0)
+		}
+		s.isCurrentlyHigh = false
+		s.exceededSince = time.Time{}
+		s.highSince = time.Time{}
+		s.stuck = false
+
+		released = append(released, PressureThresholdEvent{
+			Resource:   k.resource,
+			CgroupName: k.cgroup,
+			State:      PressurePaused,
+			Timestamp:  time.Now(),
+			Window:     w.window(),
+			Value:      s.lastAverage,
+			Threshold:  w.threshold(k.resource),
+		})
+	}
+	w.aggregatedHigh = false
+	return released
+}
@@ -0,0 +1,129 @@
+package pressurecooker
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+type testNode struct {
+	mu    sync.Mutex
+	node  v1.Node
+	reads int
+}
+
+func (n *testNode) get() (*v1.Node, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.reads++
+	return n.node.DeepCopy(), nil
+}
+
+func (n *testNode) setDisabled(w *Watcher, disabled string) {
+	n.mu.Lock()
+	n.node.Annotations = map[string]string{DisableAnnotation: disabled}
+	n.mu.Unlock()
+
+	// skip the cache
+	w.mu.Lock()
+	w.nodeCheckedAt = w.nodeCheckedAt.Add(-nodeRefreshInterval)
+	w.mu.Unlock()
+}
+
+func TestPausedByNodeAnnotation(t *testing.T) {
+	pressure := &testPressure{pressure: 50}
+	node := &testNode{}
+	w := newTestWatcher(t, WatcherConfig{PressureThreshold: 25, Node: node.get}, pressure)
+
+	if evt, ok := tickState(t, w); !ok || evt.State != PressureExceeded {
+		t.Fatalf("expected the threshold to be exceeded, got %+v", evt)
+	}
+	if evt, ok := tickState(t, w); !ok || evt.State != PressureHigh {
+		t.Fatalf("expected the pressure to stay high, got %+v", evt)
+	}
+	if node.reads != 1 {
+		t.Errorf("expected the node to be read once, got %d reads", node.reads)
+	}
+
+	node.setDisabled(w, "true")
+	if evt, ok := tickState(t, w); !ok || evt.State != PressurePaused || evt.Value != 50 {
+		t.Fatalf("expected the high resource to be released, got %+v", evt)
+	}
+	pressure.set(0)
+	if evt, ok := tickState(t, w); ok {
+		t.Fatalf("paused watcher reported %+v", evt)
+	}
+	pressure.set(50)
+	if evt, ok := tickState(t, w); ok {
+		t.Fatalf("paused watcher reported %+v", evt)
+	}
+
+	node.setDisabled(w, "false")
+	if evt, ok := tickState(t, w); !ok || evt.State != PressureExceeded {
+		t.Fatalf("expected the threshold to be exceeded once enabled, got %+v", evt)
+	}
+}
+
+func TestDisabledWhileHigh(t *testing.T) {
+	pressure := &testPressure{pressure: 50}
+	node := &testNode{}
+	w := newTestWatcher(t, WatcherConfig{Resources: []Resource{ResourceCPU, ResourceMemory}, PressureThreshold: 25, Node: node.get}, pressure)
+	// the node is tainted from a previous run
+	w.SetAsHigh(true)
+
+	node.setDisabled(w, "true")
+	events, err := w.Tick(context.Background())
+	if err != nil {
+		t.Fatalf("tick failed: %s", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected every high resource to be released, got %+v", events)
+	}
+	for i, r := range []Resource{ResourceCPU, ResourceMemory} {
+		if events[i].State != PressurePaused || events[i].Resource != r || events[i].Window != Window60 || events[i].Threshold != 25 {
+			t.Errorf("expected %s to be paused, got %+v", r, events[i])
+		}
+	}
+	for _, r := range []Resource{ResourceCPU, ResourceMemory} {
+		if w.stateFor(stateKey{resource: r}).isCurrentlyHigh {
+			t.Errorf("%s is still high", r)
+		}
+	}
+
+	// pausing again does not release anything
+	node.setDisabled(w, "true")
+	if events, err := w.Tick(context.Background()); err != nil || len(events) != 0 {
+		t.Errorf("expected no events while paused, got %+v, %v", events, err)
+	}
+}
+
+func TestIsNodeDisabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		labels      map[string]string
+		disabled    bool
+	}{
+		{"nothing set", nil, nil, false},
+		{"annotation true", map[string]string{DisableAnnotation: "true"}, nil, true},
+		{"annotation TRUE", map[string]string{DisableAnnotation: "TRUE"}, nil, true},
+		{"annotation false", map[string]string{DisableAnnotation: "false"}, nil, false},
+		{"annotation invalid", map[string]string{DisableAnnotation: "yes please"}, nil, false},
+		{"label false", nil, map[string]string{EnabledLabel: "false"}, true},
+		{"label FALSE", nil, map[string]string{EnabledLabel: "FALSE"}, true},
+		{"label true", nil, map[string]string{EnabledLabel: "true"}, false},
+		{"label true, annotation true", map[string]string{DisableAnnotation: "true"}, map[string]string{EnabledLabel: "true"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &v1.Node{}
+			node.Annotations = tt.annotations
+			node.Labels = tt.labels
+			if IsNodeDisabled(node) != tt.disabled {
+				t.Errorf("expected disabled=%t", tt.disabled)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// WatcherOption tunes the configuration passed to NewWatcher.
+type WatcherOption func(cfg *WatcherConfig) error
+
+func WithTickerInterval(interval time.Duration) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if interval <= 0 {
+			return fmt.Errorf("ticker interval must be positive, got %s", interval)
+		}
+		cfg.TickerInterval = interval
+		return nil
+	}
+}
+
+func WithWindow(window Window) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if !window.valid() {
+			return fmt.Errorf("unknown pressure window %d, expected one of 10, 60 or 300", int(window))
+		}
+		cfg.Window = window
+		return nil
+	}
+}
+
+func WithStallType(stallType StallType) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if _, err := ParseStallType(string(stallType)); err != nil {
+			return err
+		}
+		cfg.StallType = stallType
+		return nil
+	}
+}
+
+// WithResource sets the resources to watch, cpu if not given. Repeating it
+// adds to the resources of the previous options, not to the cpu default.
+func WithResource(resources ...Resource) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		for _, r := range resources {
+			if _, err := ParseResource(string(r)); err != nil {
+				return err
+			}
+		}
+		cfg.Resources = append(cfg.Resources, resources...)
+		return nil
+	}
+}
+
+func WithProcPath(path string) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if path == "" {
+			return fmt.Errorf("procfs path must not be empty")
+		}
+		cfg.ProcPath = path
+		return nil
+	}
+}
+
+// WithCgroupRoot sets the cgroup v2 mount point used by ReadCgroup.
+func WithCgroupRoot(path string) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if path == "" {
+			return fmt.Errorf("cgroup root must not be empty")
+		}
+		cfg.CgroupRoot = path
+		return nil
+	}
+}
+
+// WithCgroup watches the pressure of the cgroup at path in addition to the
+// node-wide pressure, reporting it under name.
+func WithCgroup(name, path string) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if name == "" || path == "" {
+			return fmt.Errorf("cgroup name and path must not be empty")
+		}
+		cfg.Cgroups = append(cfg.Cgroups, Cgroup{Name: name, Path: path})
+		return nil
+	}
+}
+
+// WithRiseRate reports resources below the threshold as PressureRising when
+// their pressure rises by at least rate percentage points per minute.
+func WithRiseRate(rate float64) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if rate < 0 {
+			return fmt.Errorf("rise rate must not be negative, got %f", rate)
+		}
+		cfg.RiseRate = rate
+		return nil
+	}
+}
+
+// WithThreshold overrides the pressure threshold of a single resource.
+func WithThreshold(r Resource, threshold float64) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if _, err := ParseResource(string(r)); err != nil {
+			return err
+		}
+		if threshold <= 0 {
+			return fmt.Errorf("%s pressure threshold must be positive, got %f", r, threshold)
+		}
+		if cfg.Thresholds == nil {
+			cfg.Thresholds = make(map[Resource]float64)
+		}
+		cfg.Thresholds[r] = threshold
+		return nil
+	}
+}
+
+// WithLogger logs through l instead of glog.
+func WithLogger(l logr.Logger) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		cfg.Logger = l
+		return nil
+	}
+}
+
+// WithWarmup only logs the pressure for the given time after Run was called.
+func WithWarmup(warmup time.Duration) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if warmup < 0 {
+			return fmt.Errorf("warmup must not be negative, got %s", warmup)
+		}
+		cfg.Warmup = warmup
+		return nil
+	}
+}
+
+// WithPSIReader reads the pressure from reader instead of procfs.
+func WithPSIReader(reader PSIReader) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if reader == nil {
+			return fmt.Errorf("psi reader must not be nil")
+		}
+		cfg.PSIReader = reader
+		return nil
+	}
+}
+
+// WithStuckAfter reports resources staying high for longer than d as
+// PressureStuck.
+func WithStuckAfter(d time.Duration) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if d < 0 {
+			return fmt.Errorf("stuck-after duration must not be negative, got %s", d)
+		}
+		cfg.StuckAfter = d
+		return nil
+	}
+}
+
+// WithNode pauses the watcher while the node returned by node is disabled,
+// see DisableAnnotation.
+func WithNode(node NodeAccessor) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if node == nil {
+			return fmt.Errorf("node accessor must not be nil")
+		}
+		cfg.Node = node
+		return nil
+	}
+}
+
+// WithSmoothing compares an exponential moving average of the window average
+// against the thresholds, see Watcher.Smoothing.
+func WithSmoothing(factor float64) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if factor < 0 || factor > 1 {
+			return fmt.Errorf("smoothing must be between 0 and 1, got %f", factor)
+		}
+		cfg.Smoothing = factor
+		return nil
+	}
+}
+
+// WithAggregation combines the node-wide resources into a single state, see
+// Aggregation.
+func WithAggregation(a Aggregation) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if _, err := ParseAggregation(string(a)); err != nil {
+			return err
+		}
+		cfg.Aggregation = a
+		return nil
+	}
+}
+
+// WithJitter randomizes the ticker interval by up to the given fraction, see
+// Watcher.Jitter.
+func WithJitter(fraction float64) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if fraction < 0 || fraction >= 1 {
+			return fmt.Errorf("jitter must be at least 0 and below 1, got %f", fraction)
+		}
+		cfg.Jitter = fraction
+		return nil
+	}
+}
+
+// WithReadRetries retries failed or empty reads, see Watcher.ReadRetries.
+func WithReadRetries(retries int) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if retries < 0 {
+			return fmt.Errorf("read retries must not be negative, got %d", retries)
+		}
+		cfg.ReadRetries = retries
+		return nil
+	}
+}
+
+// WithBaseline enables adaptive thresholds of deviations standard deviations
+// above a baseline learnt from the given number of samples, see
+// Watcher.BaselineDeviations.
+func WithBaseline(deviations float64, samples int) WatcherOption {
+	return func(cfg *WatcherConfig) error {
+		if deviations <= 0 {
+			return fmt.Errorf("baseline deviations must be positive, got %f", deviations)
+		}
+		if samples < 0 {
+			return fmt.Errorf("baseline samples must not be negative, got %d", samples)
+		}
+		cfg.BaselineDeviations = deviations
+		cfg.BaselineSamples = samples
+		return nil
+	}
+}
@@ -0,0 +1,34 @@
+package pressurecooker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWithResource(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []WatcherOption
+		resources []Resource
+	}{
+		{"default", nil, []Resource{ResourceCPU}},
+		{"replaces the default", []WatcherOption{WithResource(ResourceMemory)}, []Resource{ResourceMemory}},
+		{"several", []WatcherOption{WithResource(ResourceMemory, ResourceIO)}, []Resource{ResourceMemory, ResourceIO}},
+		{"repeated", []WatcherOption{WithResource(ResourceIO), WithResource(ResourceCPU)}, []Resource{ResourceIO, ResourceCPU}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewWatcher(25, append(tt.opts, WithPSIReader(&testPressure{}))...)
+			if err != nil {
+				t.Fatalf("could not create watcher: %s", err)
+			}
+			if !reflect.DeepEqual(w.Resources, tt.resources) {
+				t.Errorf("expected %v, got %v", tt.resources, w.Resources)
+			}
+		})
+	}
+
+	if _, err := NewWatcher(25, WithResource("disk")); err == nil {
+		t.Errorf("accepted an unknown resource")
+	}
+}
@@ -0,0 +1,113 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/procfs"
+)
+
+// DefaultMemoryCgroupV1 is the cgroup v1 memory controller of the node.
+const DefaultMemoryCgroupV1 = "/sys/fs/cgroup/memory"
+
+// memoryPressureLevels are the levels of cgroup v1 memory.pressure_level
+// notifications and the pressure in percent they are reported as.
+var memoryPressureLevels = []struct {
+	name     string
+	pressure float64
+}{
+	{"low", 10},
+	{"medium", 50},
+	{"critical", 90},
+}
+
+// MemoryPressureLevelReader is a PSIReader for nodes without /proc/pressure,
+// e.g. older kernels with cgroup v1. It listens to the memory.pressure_level
+// notifications of a memory cgroup and reports memory pressure only: each
+// window average is the pressure of the highest level notified within the
+// window, 10% for low, 50% for medium and 90% for critical. The total stall
+// time is not available and always zero.
+type MemoryPressureLevelReader struct {
+	mu       sync.Mutex
+	notified []time.Time
+	files    []*os.File
+}
+
+// NewMemoryPressureLevelReader registers for the notifications of the memory
+// cgroup at path, DefaultMemoryCgroupV1 if empty. Close stops listening.
+func NewMemoryPressureLevelReader(path string) (*MemoryPressureLevelReader, error) {
+	if path == "" {
+		path = DefaultMemoryCgroupV1
+	}
+
+	r := &MemoryPressureLevelReader{
+		notified: make([]time.Time, len(memoryPressureLevels)),
+	}
+	for i, level := range memoryPressureLevels {
+		events, err := r.listen(path, level.name)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("could not listen to %s memory pressure of %s: %s", level.name, path, err.Error())
+		}
+		go r.receive(i, events)
+	}
+
+	return r, nil
+}
+
+// receive records the notifications of level i until events is closed.
+func (r *MemoryPressureLevelReader) receive(i int, events *os.File) {
+	var buf [8]byte
+	for {
+		if _, err := events.Read(buf[:]); err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.notified[i] = time.Now()
+		r.mu.Unlock()
+	}
+}
+
+func (r *MemoryPressureLevelReader) PSIStatsForResource(resource string) (procfs.PSIStats, error) {
+	if Resource(resource) != ResourceMemory {
+		return procfs.PSIStats{}, fmt.Errorf("only memory pressure is available from memory.pressure_level, got %s", resource)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	line := &procfs.PSILine{
+		Avg10:  r.pressureWithin(now, 10*time.Second),
+		Avg60:  r.pressureWithin(now, time.Minute),
+		Avg300: r.pressureWithin(now, 5*time.Minute),
+	}
+	return procfs.PSIStats{Some: line}, nil
+}
+
+// pressureWithin returns the pressure of the highest level notified within
+// window. The caller must hold r.mu.
+func (r *MemoryPressureLevelReader) pressureWithin(now time.Time, window time.Duration) float64 {
+	pressure := 0.0
+	for i, t := range r.notified {
+		if !t.IsZero() && now.Sub(t) <= window && memoryPressureLevels[i].pressure > pressure {
+			pressure = memoryPressureLevels[i].pressure
+		}
+	}
+	return pressure
+}
+
+// Close stops listening to the notifications.
+func (r *MemoryPressureLevelReader) Close() error {
+	r.mu.Lock()
+	files := r.files
+	r.files = nil
+	r.mu.Unlock()
+
+	for _, f := range files {
+		f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// listen registers an eventfd for the notifications of level through the
+// cgroup.event_control file of the memory cgroup at path.
+func (r *MemoryPressureLevelReader) listen(path, level string) (*os.File, error) {
+	pressureLevel, err := os.Open(filepath.Join(path, "memory.pressure_level"))
+	if err != nil {
+		return nil, err
+	}
+
+	fd, _, errno := syscall.RawSyscall(syscall.SYS_EVENTFD2, 0, syscall.O_CLOEXEC|syscall.O_NONBLOCK, 0)
+	if errno != 0 {
+		pressureLevel.Close()
+		return nil, errno
+	}
+	events := os.NewFile(fd, "eventfd")
+
+	r.mu.Lock()
+	r.files = append(r.files, pressureLevel, events)
+	r.mu.Unlock()
+
+	control, err := os.OpenFile(filepath.Join(path, "cgroup.event_control"), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer control.Close()
+
+	if _, err := fmt.Fprintf(control, "%d %d %s", fd, pressureLevel.Fd(), level); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
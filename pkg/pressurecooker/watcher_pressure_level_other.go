@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package pressurecooker
+
+import (
+	"fmt"
+	"os"
+)
+
+func (r *MemoryPressureLevelReader) listen(path, level string) (*os.File, error) {
+	return nil, fmt.Errorf("memory.pressure_level notifications are only available on linux")
+}
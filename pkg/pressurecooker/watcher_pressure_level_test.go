@@ -0,0 +1,115 @@
+package pressurecooker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMemoryPressureLevelWindows(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		// notified is how long ago each level was notified, zero for never
+		notified             [3]time.Duration
+		avg10, avg60, avg300 float64
+	}{
+		{"never notified", [3]time.Duration{}, 0, 0, 0},
+		{"low just now", [3]time.Duration{time.Second}, 10, 10, 10},
+		{"medium half a minute ago", [3]time.Duration{0, 30 * time.Second}, 0, 50, 50},
+		{"critical four minutes ago", [3]time.Duration{0, 0, 4 * time.Minute}, 0, 0, 90},
+		{"critical too long ago", [3]time.Duration{0, 0, 10 * time.Minute}, 0, 0, 0},
+		{"highest level wins", [3]time.Duration{time.Second, 0, 2 * time.Minute}, 10, 10, 90},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &MemoryPressureLevelReader{notified: make([]time.Time, len(memoryPressureLevels))}
+			for i, ago := range tt.notified {
+				if ago != 0 {
+					r.notified[i] = now.Add(-ago)
+				}
+			}
+			r.mu.Lock()
+			avg10, avg60, avg300 := r.pressureWithin(now, 10*time.Second), r.pressureWithin(now, time.Minute), r.pressureWithin(now, 5*time.Minute)
+			r.mu.Unlock()
+			if avg10 != tt.avg10 || avg60 != tt.avg60 || avg300 != tt.avg300 {
+				t.Errorf("expected %.0f/%.0f/%.0f, got %.0f/%.0f/%.0f", tt.avg10, tt.avg60, tt.avg300, avg10, avg60, avg300)
+			}
+		})
+	}
+}
+
+func TestMemoryPressureLevelReceive(t *testing.T) {
+	events, notify, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notify.Close()
+	r := &MemoryPressureLevelReader{notified: make([]time.Time, len(memoryPressureLevels)), files: []*os.File{events}}
+	go r.receive(1, events)
+
+	if _, err := r.PSIStatsForResource("cpu"); err == nil {
+		t.Errorf("read cpu pressure from memory.pressure_level")
+	}
+	if stats, err := r.PSIStatsForResource("memory"); err != nil || stats.Some.Avg10 != 0 {
+		t.Fatalf("expected no pressure before a notification, got %+v, %v", stats.Some, err)
+	}
+
+	// an eventfd counter is 8 bytes
+	notify.Write(make([]byte, 8))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, err := r.PSIStatsForResource("memory")
+		if err != nil {
+			t.Fatalf("read failed: %s", err)
+		}
+		if stats.Some.Avg10 == 50 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("notification was not received, got %+v", stats.Some)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	r.Close()
+	if len(r.files) != 0 {
+		t.Errorf("files are still open after Close")
+	}
+}
+
+func TestNewMemoryPressureLevelReader(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("memory.pressure_level is only available on linux")
+	}
+	dir, err := ioutil.TempDir("", "pressurecooker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := NewMemoryPressureLevelReader(dir); err == nil {
+		t.Errorf("listened to a directory that is not a memory cgroup")
+	}
+
+	for _, name := range []string{"memory.pressure_level", "cgroup.event_control"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := NewMemoryPressureLevelReader(dir)
+	if err != nil {
+		t.Fatalf("could not listen: %s", err)
+	}
+	// a pressure level file and an eventfd per level
+	if len(r.files) != 2*len(memoryPressureLevels) {
+		t.Errorf("expected %d open files, got %d", 2*len(memoryPressureLevels), len(r.files))
+	}
+	if control, _ := ioutil.ReadFile(filepath.Join(dir, "cgroup.event_control")); len(control) == 0 {
+		t.Errorf("nothing was registered in cgroup.event_control")
+	}
+	r.Close()
+}
@@ -0,0 +1,32 @@
+package pressurecooker
+
+import (
+	"io"
+
+	"github.com/prometheus/procfs"
+)
+
+// PSIReader reads the pressure of a resource by its name below
+// /proc/pressure. procfs.FS implements it.
+type PSIReader interface {
+	PSIStatsForResource(resource string) (procfs.PSIStats, error)
+}
+
+// PSIReaderFunc adapts a plain function to the PSIReader interface.
+type PSIReaderFunc func(resource string) (procfs.PSIStats, error)
+
+func (f PSIReaderFunc) PSIStatsForResource(resource string) (procfs.PSIStats, error) {
+	return f(resource)
+}
+
+// NewPSIReaderFromFunc returns a PSIReader parsing the content returned by
+// open for every read, e.g. strings.NewReader with synthetic pressure files.
+func NewPSIReaderFromFunc(open func(r Resource) (io.Reader, error)) PSIReader {
+	return PSIReaderFunc(func(resource string) (procfs.PSIStats, error) {
+		content, err := open(Resource(resource))
+		if err != nil {
+			return procfs.PSIStats{}, err
+		}
+		return ParsePSIStats(content)
+	})
+}
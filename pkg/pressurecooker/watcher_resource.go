@@ -0,0 +1,83 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Resource is a resource the kernel reports pressure stall information for.
+// The value matches the file name below /proc/pressure.
+type Resource string
+
+const (
+	ResourceMemory Resource = "memory"
+	ResourceCPU    Resource = "cpu"
+	ResourceIO     Resource = "io"
+)
+
+func (r Resource) String() string {
+	return string(r)
+}
+
+// title returns the resource name as used in event reasons, e.g. "CPU"
+// for CPUPressureExceeded.
+func (r Resource) title() string {
+	switch r {
+	case ResourceMemory:
+		return "Memory"
+	case ResourceIO:
+		return "IO"
+	}
+	return strings.ToUpper(string(r))
+}
+
+func ParseResource(name string) (Resource, error) {
+	switch r := Resource(strings.ToLower(strings.TrimSpace(name))); r {
+	case ResourceMemory, ResourceCPU, ResourceIO:
+		return r, nil
+	}
+	return "", fmt.Errorf("unknown pressure resource %q, expected one of memory, cpu or io", name)
+}
+
+// ParseResources parses a comma separated list of resources, e.g. "cpu,memory".
+func ParseResources(list string) ([]Resource, error) {
+	resources := make([]Resource, 0, 3)
+	for _, name := range strings.Split(list, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		r, err := ParseResource(name)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
+
+// ParseThresholds parses a comma separated list of resource=threshold pairs,
+// e.g. "io=10,memory=20".
+func ParseThresholds(list string) (map[Resource]float64, error) {
+	thresholds := make(map[Resource]float64)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid threshold %q, expected resource=threshold", item)
+		}
+		r, err := ParseResource(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		t, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pressure threshold %q: %s", r, parts[1], err.Error())
+		}
+		thresholds[r] = t
+	}
+	return thresholds, nil
+}
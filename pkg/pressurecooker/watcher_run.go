@@ -1,59 +1,104 @@
 package pressurecooker
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
 
-	"github.com/golang/glog"
+	"github.com/prometheus/procfs"
 
 	"time"
 )
 
+// SetAsHigh sets the threshold state of all watched resources, e.g. to
+// resume from an existing node taint. Cgroups are not affected.
 func (w *Watcher) SetAsHigh(high bool) {
-	w.isCurrentlyHigh = high
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, r := range w.Resources {
+		s := w.stateFor(stateKey{resource: r})
+		s.isCurrentlyHigh = high
+		if high && s.highSince.IsZero() {
+			s.highSince = time.Now()
+		}
+	}
+	w.aggregatedHigh = high
 }
 
-func (w *Watcher) Run(closeChan chan struct{}) (<-chan PressureThresholdEvent, <-chan PressureThresholdEvent, <-chan error) {
+// Reset forgets the threshold state of all resources and cgroups, i.e. which
+// of them are high, pending SustainedFor waits and the rate of change. Use it
+// after changing the thresholds so the old state does not cause spurious
+// events.
+func (w *Watcher) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.state = make(map[stateKey]*resourceState, len(w.state))
+	w.lastExceeded = time.Time{}
+}
+
+// Run polls the pressure of all watched resources every TickerInterval until
+// ctx is cancelled. High resources are reported on the first channel,
+// resources below the threshold on the second; the State of an event tells
+// whether the resource just crossed the threshold. With RiseRate set, rising
+// resources are reported on the first channel as well. Events of watched
+// cgroups are reported on the same channels with CgroupName set. All returned
+// channels are closed once the loop has stopped, see also Shutdown and Stop.
+//
+// Only one loop runs at a time: calling Run again while the loop is active
+// returns the channels of the active loop and ignores ctx. Once the loop
+// stopped, Run starts a new one.
+//
+// Run keeps the separate exceeded and deceeded channels the controller was
+// built on instead of a single event channel; Tick returns both in one slice.
+// Only cpu is watched by default, as before, see Resources to watch memory.
+func (w *Watcher) Run(ctx context.Context) (<-chan PressureThresholdEvent, <-chan PressureThresholdEvent, <-chan error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.running() {
+		w.log().Info("watcher is already running, returning the channels of the active loop")
+		return w.exceeded, w.deceeded, w.errs
+	}
+
 	exceeded := make(chan PressureThresholdEvent)
 	deceeded := make(chan PressureThresholdEvent)
 	errs := make(chan error)
-	ticker := time.Tick(w.TickerInterval)
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	timer := time.NewTimer(w.interval(rnd))
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	w.startedAt = time.Now()
+	w.stop = stop
+	w.cancel = cancel
+	w.done = done
+	w.exceeded, w.deceeded, w.errs = exceeded, deceeded, errs
 
 	go func() {
 		defer func() {
+			timer.Stop()
+			w.logFinalState()
 			close(exceeded)
 			close(deceeded)
 			close(errs)
+			cancel()
+			close(done)
 		}()
 
 		for {
 			select {
-			case <-ticker:
-				cpu, err := w.proc.PSIStatsForResource("cpu")
-				if err != nil {
-					errs <- err
-					continue
-				}
-
-				if cpu.Some == nil {
-					errs <- fmt.Errorf("could not load cpu pressure, got %v", cpu)
-					continue
+			case <-timer.C:
+				if !w.tick(ctx, exceeded, deceeded, errs) {
+					return
 				}
-
-				glog.Infof("current state: high_load=%t avg10=%.2f avg60=%.2f avg300=%.2f threshold=%.2f",
-					w.isCurrentlyHigh, cpu.Some.Avg10, cpu.Some.Avg60, cpu.Some.Avg300, w.PressureThreshold)
-
-				if cpu.Some.Avg300 >= w.PressureThreshold {
-					if !w.isCurrentlyHigh {
-						w.isCurrentlyHigh = true
-						exceeded <- PressureThresholdEvent(*cpu.Some)
-					} else if cpu.Some.Avg60 >= w.PressureThreshold && cpu.Some.Avg10 >= w.PressureThreshold {
-						exceeded <- PressureThresholdEvent(*cpu.Some)
-					}
-				} else if cpu.Some.Avg300 < w.PressureThreshold && cpu.Some.Avg60 < w.PressureThreshold && cpu.Some.Avg10 < w.PressureThreshold {
-					w.isCurrentlyHigh = false
-					deceeded <- PressureThresholdEvent(*cpu.Some)
-				}
-			case <-closeChan:
+				timer.Reset(w.interval(rnd))
+			case <-stop:
+				return
+			case <-ctx.Done():
 				return
 			}
 		}
@@ -61,3 +106,439 @@ func (w *Watcher) Run(closeChan chan struct{}) (<-chan PressureThresholdEvent, <
 
 	return exceeded, deceeded, errs
 }
+
+// Tick reads and evaluates the pressure of every watched resource and cgroup
+// once, for callers driving the watcher on their own schedule instead of Run.
+// It returns the events Run would have sent on either channel in that order;
+// the State of an event tells whether it is a transition. Reading errors do
+// not stop the tick, the first one is returned along with the events of the
+// other resources. Once ctx is cancelled, the events collected so far are
+// returned with ctx's error. Tick must not be called while Run is active.
+func (w *Watcher) Tick(ctx context.Context) ([]PressureThresholdEvent, error) {
+	events := make(chan PressureThresholdEvent)
+	errs := make(chan error)
+	done := make(chan bool, 1)
+	go func() {
+		done <- w.tick(ctx, events, events, errs)
+	}()
+
+	var collected []PressureThresholdEvent
+	var first error
+	for {
+		select {
+		case evt := <-events:
+			collected = append(collected, evt)
+		case err := <-errs:
+			if first == nil {
+				first = err
+			}
+		case ok := <-done:
+			// a cancelled tick may still have won the race to deliver
+			if !ok || ctx.Err() != nil {
+				return collected, ctx.Err()
+			}
+			return collected, first
+		}
+	}
+}
+
+// tick reads and evaluates the pressure of every watched resource once. It
+// returns false if ctx was cancelled while delivering the results.
+func (w *Watcher) tick(ctx context.Context, exceeded, deceeded chan<- PressureThresholdEvent, errs chan<- error) bool {
+	if !w.updateDisabled(ctx, deceeded) {
+		return false
+	}
+
+	if w.Aggregation != "" {
+		if !w.tickAggregated(ctx, exceeded, deceeded, errs) {
+			return false
+		}
+	} else {
+		for _, r := range w.Resources {
+			if !w.tickResource(ctx, r, exceeded, deceeded, errs) {
+				return false
+			}
+		}
+	}
+
+	for _, cg := range w.Cgroups {
+		for _, r := range w.Resources {
+			if !w.tickCgroup(ctx, cg, r, exceeded, deceeded, errs) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (w *Watcher) tickResource(ctx context.Context, r Resource, exceeded, deceeded chan<- PressureThresholdEvent, errs chan<- error) bool {
+	evt, err := w.read(ctx, r)
+	if err != nil {
+		return sendError(ctx, errs, err)
+	}
+
+	return w.evaluate(ctx, stateKey{resource: r}, evt, exceeded, deceeded)
+}
+
+func (w *Watcher) tickCgroup(ctx context.Context, cg Cgroup, r Resource, exceeded, deceeded chan<- PressureThresholdEvent, errs chan<- error) bool {
+	evt, err := w.ReadCgroup(ctx, cg.Path, r)
+	if err != nil {
+		return sendError(ctx, errs, err)
+	}
+	evt.CgroupName = cg.Name
+
+	return w.evaluate(ctx, stateKey{cgroup: cg.Name, resource: r}, evt, exceeded, deceeded)
+}
+
+// evaluate updates the threshold state of k with evt and delivers the
+// resulting event, if any. Callbacks and channels are served without holding
+// the lock, so they may call back into the watcher.
+func (w *Watcher) evaluate(ctx context.Context, k stateKey, evt PressureThresholdEvent, exceeded, deceeded chan<- PressureThresholdEvent) bool {
+	paused := w.paused(evt)
+
+	w.mu.Lock()
+	if paused && !w.stateFor(k).isCurrentlyHigh {
+		w.mu.Unlock()
+		return true
+	}
+	c := w.transition(k, &evt, exceeded, deceeded)
+	w.mu.Unlock()
+
+	// a paused watcher still lets high resources recover
+	if paused && evt.State != PressureRecovered {
+		return true
+	}
+	return w.deliver(ctx, c, evt)
+}
+
+// paused reports whether new exceedances are not reported during the warmup
+// or while the node is disabled, logging evt instead.
+func (w *Watcher) paused(evt PressureThresholdEvent) bool {
+	w.mu.Lock()
+	warmupLeft := w.Warmup - time.Since(w.startedAt)
+	disabled := w.disabled
+	w.mu.Unlock()
+
+	if warmupLeft > 0 {
+		w.log().Info("warming up, not evaluating thresholds", "resource", evt.source(),
+			"avg10", evt.Avg10, "avg60", evt.Avg60, "avg300", evt.Avg300, "remaining", warmupLeft)
+		return true
+	}
+	if disabled {
+		w.log().Info("disabled on the node, not evaluating thresholds", "resource", evt.source(),
+			"avg10", evt.Avg10, "avg60", evt.Avg60, "avg300", evt.Avg300)
+		return true
+	}
+	return false
+}
+
+// deliver notifies the callbacks of threshold crossings and sends evt on c,
+// if not nil. The caller must not hold w.mu.
+func (w *Watcher) deliver(ctx context.Context, c chan<- PressureThresholdEvent, evt PressureThresholdEvent) bool {
+	if c == nil {
+		return true
+	}
+	if evt.State == PressureExceeded || evt.State == PressureRecovered || evt.State == PressureStuck || evt.State == PressurePaused {
+		w.notifyThresholdCrossed(evt)
+	}
+	return sendEvent(ctx, c, evt)
+}
+
+// transition compares evt against the thresholds, updates the state of k and
+// returns the channel evt has to be sent on, nil if none. The caller must
+// hold w.mu.
+func (w *Watcher) transition(k stateKey, evt *PressureThresholdEvent, exceeded, deceeded chan<- PressureThresholdEvent) chan<- PressureThresholdEvent {
+	state := w.stateFor(k)
+	// MinEvictionInterval is measured per resource and cgroup, only the
+	// resources combined by Aggregation share it
+	lastExceeded := &state.lastExceeded
+	if w.Aggregation != "" && k.cgroup == "" {
+		lastExceeded = &w.lastExceeded
+	}
+
+	line := &evt.PSILine
+	source := evt.source()
+	threshold, lowThreshold := w.thresholds(state, evt.Resource)
+
+	window := w.window()
+
+	average := window.average(line)
+	evt.Rate = state.rate(average, time.Now())
+	averages := window.averages(line)
+	if w.Smoothing > 0 {
+		average = state.smooth(average, w.Smoothing)
+		evt.Smoothed = average
+		averages[0] = average
+	}
+	evt.Value = average
+	evt.Threshold = threshold
+	w.learn(state, average, threshold)
+
+	log := w.log().WithValues("resource", source)
+	log.Info("current state", "high_load", state.isCurrentlyHigh,
+		"avg10", line.Avg10, "avg60", line.Avg60, "avg300", line.Avg300, "rate", evt.Rate, "smoothed", evt.Smoothed,
+		"window", window, "stall", w.StallType, "threshold", threshold, "low_threshold", lowThreshold)
+
+	if average >= threshold {
+		if !state.isCurrentlyHigh {
+			now := time.Now()
+			if state.exceededSince.IsZero() {
+				state.exceededSince = now
+			}
+			if now.Sub(state.exceededSince) < w.SustainedFor {
+				log.Info("pressure above threshold, waiting until sustained", "since", state.exceededSince.Format(time.RFC3339), "sustained_for", w.SustainedFor)
+				return nil
+			}
+			if now.Sub(*lastExceeded) < w.MinEvictionInterval {
+				log.Info("pressure above threshold again, waiting for next exceedance event", "next", lastExceeded.Add(w.MinEvictionInterval).Format(time.RFC3339))
+				return nil
+			}
+			state.isCurrentlyHigh = true
+			state.highSince = now
+			state.exceededSince = time.Time{}
+			thresholdCrossingsTotal.WithLabelValues(evt.Resource.String(), evt.CgroupName, "exceeded").Inc()
+			*lastExceeded = now
+			evt.State = PressureExceeded
+			return exceeded
+		} else if w.StuckAfter > 0 && !state.stuck && time.Since(state.highSince) >= w.StuckAfter {
+			state.stuck = true
+			pressureStuck.WithLabelValues(evt.Resource.String(), evt.CgroupName).Set(1)
+			log.Info("pressure stays high despite evictions", "high_since", state.highSince.Format(time.RFC3339))
+			evt.State = PressureStuck
+			return exceeded
+		} else if allAtLeast(averages, threshold) {
+			now := time.Now()
+			if now.Sub(*lastExceeded) < w.MinEvictionInterval {
+				log.Info("pressure still high, waiting for next exceedance event", "next", lastExceeded.Add(w.MinEvictionInterval).Format(time.RFC3339))
+				return nil
+			}
+			*lastExceeded = now
+			evt.State = PressureHigh
+			return exceeded
+		}
+		return nil
+	}
+
+	state.exceededSince = time.Time{}
+	if w.RiseRate > 0 && !state.isCurrentlyHigh && evt.Rate >= w.RiseRate {
+		log.Info("pressure rising below threshold", "rate", evt.Rate, "threshold", threshold)
+		evt.State = PressureRising
+		return exceeded
+	}
+
+	if allBelow(averages, lowThreshold) {
+		evt.State = PressureNormal
+		if state.isCurrentlyHigh {
+			thresholdCrossingsTotal.WithLabelValues(evt.Resource.String(), evt.CgroupName, "recovered").Inc()
+			evt.State = PressureRecovered
+		}
+		if state.stuck {
+			pressureStuck.WithLabelValues(evt.Resource.String(), evt.CgroupName).Set(0)
+		}
+		state.isCurrentlyHigh = false
+		state.highSince = time.Time{}
+		state.stuck = false
+		return deceeded
+	}
+
+	return nil
+}
+
+// rate records avg read at now and returns the change since the previous read
+// in percentage points per minute.
+func (s *resourceState) rate(avg float64, now time.Time) float64 {
+	var rate float64
+	if !s.lastRead.IsZero() {
+		if elapsed := now.Sub(s.lastRead); elapsed > 0 {
+			rate = (avg - s.lastAverage) / elapsed.Minutes()
+		}
+	}
+	s.lastAverage = avg
+	s.lastRead = now
+	return rate
+}
+
+// smooth moves the moving average by factor towards avg and returns it. The
+// first value starts the average.
+func (s *resourceState) smooth(avg, factor float64) float64 {
+	if !s.hasSmoothed {
+		s.smoothed = avg
+		s.hasSmoothed = true
+		return avg
+	}
+	s.smoothed += factor * (avg - s.smoothed)
+	return s.smoothed
+}
+
+// Current reads the pressure of all watched resources and cgroups once.
+// Unlike Run it does not change the threshold state, so it can be used for
+// status pages.
+func (w *Watcher) Current(ctx context.Context) ([]PressureThresholdEvent, error) {
+	events := make([]PressureThresholdEvent, 0, len(w.Resources)*(len(w.Cgroups)+1))
+	for _, r := range w.Resources {
+		evt, err := w.read(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		if w.isHigh(stateKey{resource: r}) {
+			evt.State = PressureHigh
+		}
+		events = append(events, evt)
+	}
+	for _, cg := range w.Cgroups {
+		for _, r := range w.Resources {
+			evt, err := w.ReadCgroup(ctx, cg.Path, r)
+			if err != nil {
+				return nil, err
+			}
+			evt.CgroupName = cg.Name
+			evt.State = PressureNormal
+			if w.isHigh(stateKey{cgroup: cg.Name, resource: r}) {
+				evt.State = PressureHigh
+			}
+			events = append(events, evt)
+		}
+	}
+	return events, nil
+}
+
+func (w *Watcher) isHigh(k stateKey) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, ok := w.state[k]
+	return ok && s.isCurrentlyHigh
+}
+
+type psiResult struct {
+	stats procfs.PSIStats
+	err   error
+}
+
+// read reads the pressure of a resource. A read that does not finish within
+// ReadTimeout or before ctx is done is abandoned and reported as an error, so
+// a stalled procfs can not block the caller.
+func (w *Watcher) read(ctx context.Context, r Resource) (PressureThresholdEvent, error) {
+	stats, err := w.readStats(ctx, r, func() (procfs.PSIStats, error) {
+		return w.proc.PSIStatsForResource(r.String())
+	})
+	if err != nil {
+		return PressureThresholdEvent{}, err
+	}
+	observePressure(r, stats)
+
+	line, stall := w.pressureLine(r, stats)
+	if line == nil {
+		return PressureThresholdEvent{}, fmt.Errorf("could not load %s %s pressure, got %v", r, w.StallType, stats)
+	}
+
+	return w.event(line, stall, r), nil
+}
+
+// event creates the event of a line of the given stall type read for
+// resource r, valued by the window average.
+func (w *Watcher) event(line *procfs.PSILine, stall StallType, r Resource) PressureThresholdEvent {
+	window := w.window()
+	return PressureThresholdEvent{
+		PSILine:   *line,
+		Resource:  r,
+		State:     PressureNormal,
+		Timestamp: time.Now(),
+		StallType: stall,
+		Window:    window,
+		Value:     window.average(line),
+		Threshold: w.threshold(r),
+	}
+}
+
+// readRetryDelay is the pause between two attempts of a failed read.
+const readRetryDelay = 100 * time.Millisecond
+
+// readStats runs load, retrying failed and empty reads up to ReadRetries
+// times. The threshold state is not touched by reads, so a read that fails
+// for good leaves the resource in its previous state.
+func (w *Watcher) readStats(ctx context.Context, r Resource, load func() (procfs.PSIStats, error)) (procfs.PSIStats, error) {
+	for attempt := 0; ; attempt++ {
+		stats, err := w.readStatsOnce(ctx, r, load)
+		if err == nil && stats.Some == nil {
+			err = fmt.Errorf("%s pressure is empty", r)
+		}
+		if err == nil {
+			return stats, nil
+		}
+
+		readFailuresTotal.WithLabelValues(r.String()).Inc()
+		if attempt >= w.ReadRetries || ctx.Err() != nil {
+			return stats, err
+		}
+		w.log().Info("could not read pressure, retrying", "resource", r, "attempt", attempt+1, "error", err.Error())
+
+		select {
+		case <-time.After(readRetryDelay):
+		case <-ctx.Done():
+			return stats, err
+		}
+	}
+}
+
+// readStatsOnce runs load bounded by ReadTimeout and ctx.
+func (w *Watcher) readStatsOnce(ctx context.Context, r Resource, load func() (procfs.PSIStats, error)) (procfs.PSIStats, error) {
+	if w.ReadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.ReadTimeout)
+		defer cancel()
+	}
+
+	results := make(chan psiResult, 1)
+	go func() {
+		stats, err := load()
+		results <- psiResult{stats: stats, err: err}
+	}()
+
+	select {
+	case res := <-results:
+		return res.stats, res.err
+	case <-ctx.Done():
+		return procfs.PSIStats{}, fmt.Errorf("could not read %s pressure: %s", r, ctx.Err().Error())
+	}
+}
+
+// pressureLine returns the line the threshold is compared against. Some
+// kernels report io "full" as constant zero; a full line that never saw a
+// stall since boot falls back to the "some" line for io. Resources without a
+// full line, usually cpu, fall back to "some" as well. It also returns the
+// stall type of the line; fallbacks are counted in stallFallbacksTotal.
+func (w *Watcher) pressureLine(r Resource, stats procfs.PSIStats) (*procfs.PSILine, StallType) {
+	if w.StallType != StallFull {
+		return stats.Some, StallSome
+	}
+
+	if stats.Full == nil || (r == ResourceIO && stats.Full.Total == 0) {
+		stallFallbacksTotal.WithLabelValues(r.String()).Inc()
+		w.log().V(1).Info("no full pressure, falling back to some", "resource", r)
+		return stats.Some, StallSome
+	}
+
+	return stats.Full, StallFull
+}
+
+// sendEvent delivers evt unless ctx gets cancelled first, so a consumer that
+// stopped reading can not block the loop forever.
+func sendEvent(ctx context.Context, c chan<- PressureThresholdEvent, evt PressureThresholdEvent) bool {
+	select {
+	case c <- evt:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func sendError(ctx context.Context, c chan<- error, err error) bool {
+	select {
+	case c <- err:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
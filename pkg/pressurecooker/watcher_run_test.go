@@ -0,0 +1,286 @@
+package pressurecooker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/procfs"
+)
+
+type tickStep struct {
+	pressure float64
+	// wait delays the read
+	wait time.Duration
+	// state is the expected state, empty if no event is expected
+	state PressureState
+}
+
+func TestTickTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   WatcherConfig
+		steps []tickStep
+	}{
+		{
+			name: "hysteresis",
+			cfg:  WatcherConfig{PressureThreshold: 25, LowThreshold: 15},
+			steps: []tickStep{
+				{pressure: 30, state: PressureExceeded},
+				{pressure: 20},
+				{pressure: 10, state: PressureRecovered},
+				{pressure: 20},
+				{pressure: 10, state: PressureNormal},
+			},
+		},
+		{
+			name: "stays high",
+			cfg:  WatcherConfig{PressureThreshold: 25, LowThreshold: 15},
+			steps: []tickStep{
+				{pressure: 30, state: PressureExceeded},
+				{pressure: 30, state: PressureHigh},
+				{pressure: 25, state: PressureHigh},
+			},
+		},
+		{
+			name: "low threshold defaults to the threshold",
+			cfg:  WatcherConfig{PressureThreshold: 25},
+			steps: []tickStep{
+				{pressure: 25, state: PressureExceeded},
+				{pressure: 24, state: PressureRecovered},
+				{pressure: 24, state: PressureNormal},
+			},
+		},
+		{
+			name: "sustained",
+			cfg:  WatcherConfig{PressureThreshold: 25, SustainedFor: 50 * time.Millisecond},
+			steps: []tickStep{
+				{pressure: 30},
+				{pressure: 30, wait: 60 * time.Millisecond, state: PressureExceeded},
+				{pressure: 10, state: PressureRecovered},
+			},
+		},
+		{
+			name: "spike shorter than sustained",
+			cfg:  WatcherConfig{PressureThreshold: 25, SustainedFor: time.Hour},
+			steps: []tickStep{
+				{pressure: 30},
+				{pressure: 10, state: PressureNormal},
+				{pressure: 30},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var pressure float64
+			reader := PSIReaderFunc(func(resource string) (procfs.PSIStats, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				line := procfs.PSILine{Avg10: pressure, Avg60: pressure, Avg300: pressure}
+				return procfs.PSIStats{Some: &line, Full: &line}, nil
+			})
+			w := newTestWatcher(t, tt.cfg, reader)
+
+			for i, step := range tt.steps {
+				time.Sleep(step.wait)
+				mu.Lock()
+				pressure = step.pressure
+				mu.Unlock()
+
+				events, err := w.Tick(context.Background())
+				if err != nil {
+					t.Fatalf("step %d: tick failed: %s", i, err)
+				}
+				var state PressureState
+				if len(events) > 0 {
+					state = events[0].State
+				}
+				if len(events) > 1 || state != step.state {
+					t.Fatalf("step %d: expected state %q at %.0f, got %+v", i, step.state, step.pressure, events)
+				}
+				if len(events) == 1 && (events[0].Value != step.pressure || events[0].Resource != ResourceCPU) {
+					t.Errorf("step %d: unexpected event %+v", i, events[0])
+				}
+			}
+		})
+	}
+}
+
+func TestMinEvictionIntervalAfterRecovery(t *testing.T) {
+	pressure := &testPressure{pressure: 50}
+	w := newTestWatcher(t, WatcherConfig{PressureThreshold: 25, MinEvictionInterval: 100 * time.Millisecond}, pressure)
+
+	if evt, ok := tickState(t, w); !ok || evt.State != PressureExceeded {
+		t.Fatalf("expected the threshold to be exceeded, got %+v", evt)
+	}
+	pressure.set(0)
+	if evt, ok := tickState(t, w); !ok || evt.State != PressureRecovered {
+		t.Fatalf("expected a recovery, got %+v", evt)
+	}
+
+	pressure.set(50)
+	if evt, ok := tickState(t, w); ok {
+		t.Fatalf("exceeded again within the minimum eviction interval: %+v", evt)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if evt, ok := tickState(t, w); !ok || evt.State != PressureExceeded {
+		t.Fatalf("expected the threshold to be exceeded after the interval, got %+v", evt)
+	}
+}
+
+func TestFullPressureFallback(t *testing.T) {
+	var mu sync.Mutex
+	full := true
+	reader := PSIReaderFunc(func(resource string) (procfs.PSIStats, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		some := procfs.PSILine{Avg10: 40, Avg60: 40, Avg300: 40, Total: 100}
+		stats := procfs.PSIStats{Some: &some}
+		if full {
+			stats.Full = &procfs.PSILine{Avg10: 10, Avg60: 10, Avg300: 10, Total: 50}
+		}
+		return stats, nil
+	})
+	w := newTestWatcher(t, WatcherConfig{Resources: []Resource{ResourceMemory}, StallType: StallFull, PressureThreshold: 25, Window: Window60}, reader)
+	fallbacks := stallFallbacksTotal.WithLabelValues("memory")
+	before := testutil.ToFloat64(fallbacks)
+
+	if evt, ok := tickState(t, w); !ok || evt.StallType != StallFull || evt.Window != Window60 || evt.Value != 10 {
+		t.Fatalf("expected the full pressure to be used, got %+v", evt)
+	}
+	if testutil.ToFloat64(fallbacks) != before {
+		t.Errorf("counted a fallback while full pressure was reported")
+	}
+
+	mu.Lock()
+	full = false
+	mu.Unlock()
+	evt, ok := tickState(t, w)
+	if !ok || evt.StallType != StallSome || evt.Value != 40 || evt.State != PressureExceeded {
+		t.Fatalf("expected the some pressure to be used, got %+v", evt)
+	}
+	if after := testutil.ToFloat64(fallbacks); after != before+1 {
+		t.Errorf("expected one fallback to be counted, got %f", after-before)
+	}
+}
+
+func TestTickReturnsEvents(t *testing.T) {
+	pressure := map[string]float64{"cpu": 50, "memory": 0, "io": 50}
+	reader := PSIReaderFunc(func(resource string) (procfs.PSIStats, error) {
+		line := procfs.PSILine{Avg10: pressure[resource], Avg60: pressure[resource], Avg300: pressure[resource]}
+		return procfs.PSIStats{Some: &line, Full: &line}, nil
+	})
+	w := newTestWatcher(t, WatcherConfig{Resources: []Resource{ResourceCPU, ResourceMemory, ResourceIO}, PressureThreshold: 25}, reader)
+
+	events, err := w.Tick(context.Background())
+	if err != nil {
+		t.Fatalf("tick failed: %s", err)
+	}
+	expected := []struct {
+		resource Resource
+		state    PressureState
+	}{
+		{ResourceCPU, PressureExceeded},
+		{ResourceMemory, PressureNormal},
+		{ResourceIO, PressureExceeded},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events)
+	}
+	for i, e := range expected {
+		if events[i].Resource != e.resource || events[i].State != e.state {
+			t.Errorf("event %d: expected %s %q, got %+v", i, e.resource, e.state, events[i])
+		}
+	}
+}
+
+func TestTickReturnsFirstError(t *testing.T) {
+	var mu sync.Mutex
+	failing := false
+	reader := PSIReaderFunc(func(resource string) (procfs.PSIStats, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing && resource != "memory" {
+			return procfs.PSIStats{}, fmt.Errorf("%s failed", resource)
+		}
+		line := procfs.PSILine{Avg10: 50, Avg60: 50, Avg300: 50}
+		return procfs.PSIStats{Some: &line, Full: &line}, nil
+	})
+	w := newTestWatcher(t, WatcherConfig{Resources: []Resource{ResourceCPU, ResourceMemory, ResourceIO}, PressureThreshold: 25}, reader)
+	mu.Lock()
+	failing = true
+	mu.Unlock()
+
+	events, err := w.Tick(context.Background())
+	if err == nil || err.Error() != "cpu failed" {
+		t.Errorf("expected the first error, got %v", err)
+	}
+	if len(events) != 1 || events[0].Resource != ResourceMemory || events[0].State != PressureExceeded {
+		t.Errorf("expected the events of the other resources, got %+v", events)
+	}
+}
+
+func TestTickCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	armed := false
+	reader := PSIReaderFunc(func(resource string) (procfs.PSIStats, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if armed && resource == "memory" {
+			cancel()
+		}
+		line := procfs.PSILine{Avg10: 50, Avg60: 50, Avg300: 50}
+		return procfs.PSIStats{Some: &line, Full: &line}, nil
+	})
+	w := newTestWatcher(t, WatcherConfig{Resources: []Resource{ResourceCPU, ResourceMemory}, PressureThreshold: 25}, reader)
+	mu.Lock()
+	armed = true
+	mu.Unlock()
+
+	events, err := w.Tick(ctx)
+	if err != context.Canceled {
+		t.Errorf("expected the context's error, got %v", err)
+	}
+	if len(events) == 0 || events[0].Resource != ResourceCPU {
+		t.Errorf("expected the events collected before the cancellation, got %+v", events)
+	}
+}
+
+func TestMinEvictionIntervalPerResource(t *testing.T) {
+	var mu sync.Mutex
+	pressure := map[string]float64{"cpu": 50, "memory": 0}
+	reader := PSIReaderFunc(func(resource string) (procfs.PSIStats, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		line := procfs.PSILine{Avg10: pressure[resource], Avg60: pressure[resource], Avg300: pressure[resource]}
+		return procfs.PSIStats{Some: &line, Full: &line}, nil
+	})
+	w := newTestWatcher(t, WatcherConfig{
+		Resources:           []Resource{ResourceCPU, ResourceMemory},
+		PressureThreshold:   25,
+		MinEvictionInterval: time.Hour,
+	}, reader)
+
+	events, err := w.Tick(context.Background())
+	if err != nil || len(events) != 2 || events[0].State != PressureExceeded {
+		t.Fatalf("expected cpu to exceed the threshold, got %+v, %v", events, err)
+	}
+	mu.Lock()
+	pressure["memory"] = 50
+	mu.Unlock()
+
+	// cpu waits for its interval, memory is not held back by it
+	events, err = w.Tick(context.Background())
+	if err != nil {
+		t.Fatalf("tick failed: %s", err)
+	}
+	if len(events) != 1 || events[0].Resource != ResourceMemory || events[0].State != PressureExceeded {
+		t.Errorf("expected only memory to exceed the threshold, got %+v", events)
+	}
+}
@@ -0,0 +1,64 @@
+package pressurecooker
+
+import "context"
+
+// Runnable adapts the run loop of a watcher to controller-runtime's
+// manager.Runnable, e.g. mgr.Add(pressurecooker.NewRunnable(w, handle)).
+type Runnable struct {
+	Watcher *Watcher
+	// Handle receives every event, exceeded and deceeded alike.
+	Handle func(PressureThresholdEvent)
+	// HandleError receives read errors, which are logged if nil.
+	HandleError func(error)
+}
+
+func NewRunnable(w *Watcher, handle func(PressureThresholdEvent)) *Runnable {
+	return &Runnable{
+		Watcher: w,
+		Handle:  handle,
+	}
+}
+
+// Start runs the watcher until ctx is done or the watcher is shut down. Read
+// errors are handed to HandleError, so Start itself always returns nil.
+func (r *Runnable) Start(ctx context.Context) error {
+	exceeded, deceeded, errs := r.Watcher.Run(ctx)
+	for exceeded != nil || deceeded != nil || errs != nil {
+		select {
+		case evt, ok := <-exceeded:
+			if !ok {
+				exceeded = nil
+				continue
+			}
+			r.handle(evt)
+		case evt, ok := <-deceeded:
+			if !ok {
+				deceeded = nil
+				continue
+			}
+			r.handle(evt)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if r.HandleError != nil {
+				r.HandleError(err)
+			} else {
+				r.Watcher.log().Error(err, "could not read pressure")
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Runnable) handle(evt PressureThresholdEvent) {
+	if r.Handle != nil {
+		r.Handle(evt)
+	}
+}
+
+// NeedLeaderElection returns false: every node runs its own watcher.
+func (r *Runnable) NeedLeaderElection() bool {
+	return false
+}
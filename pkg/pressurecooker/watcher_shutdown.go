@@ -0,0 +1,95 @@
+package pressurecooker
+
+import (
+	"context"
+)
+
+// Shutdown stops the loop started by Run after the current tick finished and
+// waits until all channels are closed. If ctx is done first, the current tick
+// is abandoned, e.g. a pending read or an event nobody receives, and ctx's
+// error is returned once the loop stopped.
+func (w *Watcher) Shutdown(ctx context.Context) error {
+	w.mu.Lock()
+	stop, cancel, done := w.stop, w.cancel, w.done
+	w.stop = nil
+	w.mu.Unlock()
+
+	if done == nil {
+		w.closeReader()
+		return nil
+	}
+	if stop != nil {
+		close(stop)
+	}
+
+	defer w.closeReader()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Stop stops the loop started by Run without waiting for the current tick,
+// like a cancelled context, and returns once all channels are closed. It must
+// not be called from a callback, as callbacks run on the loop. See Shutdown
+// to let the current tick finish. Both close the MemoryPressureLevelReader
+// created by NewWatcherFromConfig, a watcher using it can not be run again.
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.mu.Unlock()
+
+	if done == nil {
+		w.closeReader()
+		return
+	}
+	cancel()
+	<-done
+	w.closeReader()
+}
+
+// closeReader closes the reader created by NewWatcherFromConfig, e.g. the
+// eventfds of a MemoryPressureLevelReader. The watcher can not read pressure
+// afterwards.
+func (w *Watcher) closeReader() {
+	w.mu.Lock()
+	closer := w.closer
+	w.closer = nil
+	w.mu.Unlock()
+
+	if closer != nil {
+		closer.Close()
+	}
+}
+
+// running reports whether the loop started by Run is active. The caller must
+// hold w.mu.
+func (w *Watcher) running() bool {
+	if w.done == nil {
+		return false
+	}
+	select {
+	case <-w.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// logFinalState logs the threshold state when the loop stops.
+func (w *Watcher) logFinalState() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for k, s := range w.state {
+		source := k.resource.String()
+		if k.cgroup != "" {
+			source = k.cgroup + "/" + source
+		}
+		w.log().Info("watcher stopped", "resource", source, "high_load", s.isCurrentlyHigh)
+	}
+}
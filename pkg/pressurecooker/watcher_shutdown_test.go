@@ -0,0 +1,153 @@
+package pressurecooker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/procfs"
+)
+
+// testPressure is a PSIReader reporting the same settable pressure in all
+// windows of every resource.
+type testPressure struct {
+	mu       sync.Mutex
+	pressure float64
+}
+
+func (p *testPressure) set(pressure float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pressure = pressure
+}
+
+func (p *testPressure) PSIStatsForResource(resource string) (procfs.PSIStats, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	line := procfs.PSILine{Avg10: p.pressure, Avg60: p.pressure, Avg300: p.pressure}
+	full := line
+	return procfs.PSIStats{Some: &line, Full: &full}, nil
+}
+
+func newTestWatcher(t *testing.T, cfg WatcherConfig, reader PSIReader) *Watcher {
+	t.Helper()
+	cfg.PSIReader = reader
+	w, err := NewWatcherFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("could not create watcher: %s", err)
+	}
+	return w
+}
+
+func waitClosedEvents(t *testing.T, name string, c <-chan PressureThresholdEvent) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-c:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("%s channel was not closed", name)
+		}
+	}
+}
+
+func TestRunTwiceReturnsSameChannels(t *testing.T) {
+	w := newTestWatcher(t, WatcherConfig{TickerInterval: time.Hour}, &testPressure{})
+	defer w.Stop()
+
+	exceeded, deceeded, errs := w.Run(context.Background())
+
+	returned := make(chan bool)
+	go func() {
+		exceeded2, deceeded2, errs2 := w.Run(context.Background())
+		returned <- exceeded2 == exceeded && deceeded2 == deceeded && errs2 == errs
+	}()
+
+	select {
+	case same := <-returned:
+		if !same {
+			t.Errorf("second Run returned new channels")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("second Run blocked")
+	}
+}
+
+func TestStopClosesChannels(t *testing.T) {
+	w := newTestWatcher(t, WatcherConfig{TickerInterval: 10 * time.Millisecond}, &testPressure{pressure: 50})
+
+	exceeded, deceeded, errs := w.Run(context.Background())
+	// wait for the loop to be busy delivering an event nobody receives
+	time.Sleep(50 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Stop did not return")
+	}
+
+	waitClosedEvents(t, "exceeded", exceeded)
+	waitClosedEvents(t, "deceeded", deceeded)
+	select {
+	case _, ok := <-errs:
+		if ok {
+			t.Errorf("unexpected error after Stop")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("error channel was not closed")
+	}
+
+	// a stopped watcher starts a new loop
+	exceeded2, _, _ := w.Run(context.Background())
+	if exceeded2 == exceeded {
+		t.Errorf("Run after Stop returned the channels of the stopped loop")
+	}
+	w.Stop()
+	w.Stop()
+}
+
+type testCloser struct {
+	closed int
+}
+
+func (c *testCloser) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestStopClosesReader(t *testing.T) {
+	for name, stop := range map[string]func(w *Watcher){
+		"stop":     func(w *Watcher) { w.Stop() },
+		"shutdown": func(w *Watcher) { w.Shutdown(context.Background()) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			closer := &testCloser{}
+			w := newTestWatcher(t, WatcherConfig{TickerInterval: 10 * time.Millisecond}, &testPressure{})
+			w.closer = closer
+
+			w.Run(context.Background())
+			stop(w)
+			stop(w)
+			if closer.closed != 1 {
+				t.Errorf("expected the reader to be closed once, got %d", closer.closed)
+			}
+		})
+	}
+
+	closer := &testCloser{}
+	w := newTestWatcher(t, WatcherConfig{}, &testPressure{})
+	w.closer = closer
+	w.Stop()
+	if closer.closed != 1 {
+		t.Errorf("expected the reader of a watcher that never ran to be closed")
+	}
+}
@@ -0,0 +1,28 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StallType selects which line of the pressure file is compared against the
+// threshold. "some" is the share of time at least one task was stalled, "full"
+// the share of time all non-idle tasks were stalled at once.
+type StallType string
+
+const (
+	StallSome StallType = "some"
+	StallFull StallType = "full"
+)
+
+func (t StallType) String() string {
+	return string(t)
+}
+
+func ParseStallType(s string) (StallType, error) {
+	switch t := StallType(strings.ToLower(strings.TrimSpace(s))); t {
+	case StallSome, StallFull:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown stall type %q, expected some or full", s)
+}
@@ -0,0 +1,156 @@
+package pressurecooker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/procfs"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// summaryStats is the part of the kubelet's /stats/summary used by
+// SummaryReader.
+type summaryStats struct {
+	Node struct {
+		CPU struct {
+			UsageNanoCores *uint64 `json:"usageNanoCores"`
+		} `json:"cpu"`
+		Memory struct {
+			WorkingSetBytes *uint64 `json:"workingSetBytes"`
+		} `json:"memory"`
+	} `json:"node"`
+}
+
+// summarySample is the usage of a resource in percent of the allocatable at
+// the time it was read.
+type summarySample struct {
+	at    time.Time
+	usage float64
+}
+
+// SummaryReader is a PSIReader for nodes without pressure stall information,
+// e.g. managed clusters without PSI enabled kernels. It reads the node's usage
+// from the kubelet summary API through the API server's node proxy and
+// reports it in percent of the node's allocatable: the memory working set for
+// memory, the cpu usage for cpu. Each window average is the average of the
+// reads within the window; the total stall time is not available and always
+// zero. io is not supported.
+//
+// Usage is not stall time: a node using 80% of its allocatable memory might
+// not stall at all, so the thresholds usually have to be raised.
+type SummaryReader struct {
+	client   kubernetes.Interface
+	nodeName string
+
+	mu      sync.Mutex
+	samples map[Resource][]summarySample
+}
+
+func NewSummaryReader(client kubernetes.Interface, nodeName string) *SummaryReader {
+	return &SummaryReader{
+		client:   client,
+		nodeName: nodeName,
+		samples:  make(map[Resource][]summarySample),
+	}
+}
+
+func (r *SummaryReader) PSIStatsForResource(resource string) (procfs.PSIStats, error) {
+	res := Resource(resource)
+	if res != ResourceMemory && res != ResourceCPU {
+		return procfs.PSIStats{}, fmt.Errorf("only cpu and memory usage is available from the kubelet summary, got %s", resource)
+	}
+
+	usage, err := r.usage(res)
+	if err != nil {
+		return procfs.PSIStats{}, err
+	}
+	return procfs.PSIStats{Some: r.record(res, usage, time.Now())}, nil
+}
+
+// record adds a sample read at now and returns the window averages.
+func (r *SummaryReader) record(res Resource, usage float64, now time.Time) *procfs.PSILine {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	samples := append(r.samples[res], summarySample{at: now, usage: usage})
+	// drop the samples that fell out of the longest window
+	for len(samples) > 1 && now.Sub(samples[0].at) > 5*time.Minute {
+		samples = samples[1:]
+	}
+	r.samples[res] = samples
+
+	return &procfs.PSILine{
+		Avg10:  averageWithin(samples, now, 10*time.Second),
+		Avg60:  averageWithin(samples, now, time.Minute),
+		Avg300: averageWithin(samples, now, 5*time.Minute),
+	}
+}
+
+// usage reads the usage of resource in percent of the node's allocatable.
+func (r *SummaryReader) usage(resource Resource) (float64, error) {
+	node, err := r.client.CoreV1().Nodes().Get(r.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	raw, err := r.client.CoreV1().RESTClient().Get().
+		Resource("nodes").Name(r.nodeName).SubResource("proxy").Suffix("stats/summary").
+		DoRaw()
+	if err != nil {
+		return 0, fmt.Errorf("could not read the kubelet summary of %s: %s", r.nodeName, err.Error())
+	}
+	return summaryUsage(node, raw, resource)
+}
+
+// summaryUsage returns the usage of resource in the kubelet summary raw in
+// percent of the allocatable of node.
+func summaryUsage(node *v1.Node, raw []byte, resource Resource) (float64, error) {
+	var stats summaryStats
+	if err := json.Unmarshal(raw, &stats); err != nil {
+		return 0, fmt.Errorf("could not parse the kubelet summary of %s: %s", node.Name, err.Error())
+	}
+
+	var used, allocatable float64
+	switch resource {
+	case ResourceMemory:
+		if stats.Node.Memory.WorkingSetBytes == nil {
+			return 0, fmt.Errorf("kubelet summary of %s has no memory working set", node.Name)
+		}
+		used = float64(*stats.Node.Memory.WorkingSetBytes)
+		allocatable = float64(node.Status.Allocatable.Memory().Value())
+	case ResourceCPU:
+		if stats.Node.CPU.UsageNanoCores == nil {
+			return 0, fmt.Errorf("kubelet summary of %s has no cpu usage", node.Name)
+		}
+		used = float64(*stats.Node.CPU.UsageNanoCores)
+		allocatable = float64(node.Status.Allocatable.Cpu().MilliValue()) * 1e6
+	}
+	if allocatable <= 0 {
+		return 0, fmt.Errorf("node %s reports no allocatable %s", node.Name, resource)
+	}
+
+	usage := used / allocatable * 100
+	if usage > 100 {
+		usage = 100
+	}
+	return usage, nil
+}
+
+// averageWithin returns the average usage of the samples read within window.
+func averageWithin(samples []summarySample, now time.Time, window time.Duration) float64 {
+	sum, n := 0.0, 0
+	for _, s := range samples {
+		if now.Sub(s.at) <= window {
+			sum += s.usage
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
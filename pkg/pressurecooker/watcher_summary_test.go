@@ -0,0 +1,87 @@
+package pressurecooker
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSummaryUsage(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Status: v1.NodeStatus{Allocatable: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("4"),
+			v1.ResourceMemory: resource.MustParse("8Gi"),
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		node     *v1.Node
+		summary  string
+		resource Resource
+		usage    float64
+		valid    bool
+	}{
+		{"memory", node, `{"node":{"memory":{"workingSetBytes":2147483648}}}`, ResourceMemory, 25, true},
+		{"cpu", node, `{"node":{"cpu":{"usageNanoCores":3000000000}}}`, ResourceCPU, 75, true},
+		{"above allocatable", node, `{"node":{"cpu":{"usageNanoCores":8000000000}}}`, ResourceCPU, 100, true},
+		{"no working set", node, `{"node":{"cpu":{"usageNanoCores":1}}}`, ResourceMemory, 0, false},
+		{"no cpu usage", node, `{"node":{"memory":{"workingSetBytes":1}}}`, ResourceCPU, 0, false},
+		{"no allocatable", &v1.Node{}, `{"node":{"memory":{"workingSetBytes":1}}}`, ResourceMemory, 0, false},
+		{"invalid summary", node, `not json`, ResourceMemory, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage, err := summaryUsage(tt.node, []byte(tt.summary), tt.resource)
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatalf("expected an error")
+			}
+			if usage != tt.usage {
+				t.Errorf("expected %f, got %f", tt.usage, usage)
+			}
+		})
+	}
+}
+
+func TestSummaryWindows(t *testing.T) {
+	r := NewSummaryReader(nil, "node")
+	start := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		after  time.Duration
+		usage  float64
+		avg10  float64
+		avg60  float64
+		avg300 float64
+	}{
+		{0, 30, 30, 30, 30},
+		{5 * time.Second, 60, 45, 45, 45},
+		{30 * time.Second, 90, 90, 60, 60},
+		{4 * time.Minute, 20, 20, 20, 50},
+		// the first samples fell out of every window
+		{10 * time.Minute, 10, 10, 10, 10},
+	}
+	for i, tt := range tests {
+		line := r.record(ResourceMemory, tt.usage, start.Add(tt.after))
+		if line.Avg10 != tt.avg10 || line.Avg60 != tt.avg60 || line.Avg300 != tt.avg300 {
+			t.Errorf("read %d: expected %.0f/%.0f/%.0f, got %+v", i, tt.avg10, tt.avg60, tt.avg300, line)
+		}
+	}
+	if n := len(r.samples[ResourceMemory]); n != 1 {
+		t.Errorf("expected old samples to be dropped, kept %d", n)
+	}
+	if line := r.record(ResourceCPU, 40, start.Add(10*time.Minute)); line.Avg300 != 40 {
+		t.Errorf("resources share their samples: %+v", line)
+	}
+
+	if _, err := r.PSIStatsForResource("io"); err == nil {
+		t.Errorf("io was read from the summary")
+	}
+}
@@ -1,34 +1,309 @@
 package pressurecooker
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
 	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/prometheus/procfs"
 )
 
-type PressureThresholdEvent procfs.PSILine
+// PressureThresholdEvent is the pressure of a resource at the time it was
+// read. Besides the running averages, PSILine.Total is the total stall time
+// since boot in microseconds, see StallTime.
+type PressureThresholdEvent struct {
+	procfs.PSILine
+	Resource Resource
+	// Cgroup is the path of the cgroup the pressure was read from, empty for
+	// the node-wide pressure.
+	Cgroup string
+	// CgroupName is the name the cgroup was registered with, see
+	// Watcher.Cgroups.
+	CgroupName string
+	State      PressureState
+	// Rate is the change of the window average since the previous read in
+	// percentage points per minute, zero for the first read.
+	Rate float64
+	// Timestamp is when the pressure was read.
+	Timestamp time.Time
+	// StallType and Window tell which line and average Value was taken from.
+	// StallType is "some" if "full" was configured but not reported.
+	StallType StallType
+	Window    Window
+	// Smoothed is the moving average the thresholds were compared against,
+	// see Watcher.Smoothing. It is zero if smoothing is disabled.
+	Smoothed float64
+	// Value is the pressure compared against Threshold: the window average,
+	// or Smoothed if smoothing is enabled.
+	Value     float64
+	Threshold float64
+	// HighResources are the resources currently high, only set on the
+	// combined events of Watcher.Aggregation.
+	HighResources []Resource
+}
+
+// Excess returns how many percentage points the pressure is above the
+// threshold, negative if it is below.
+func (e PressureThresholdEvent) Excess() float64 {
+	return e.Value - e.Threshold
+}
+
+// StallTime returns the total stall time since boot. Two events of the same
+// resource give the exact stall time between them, independent of the
+// kernel's 10, 60 and 300 second windows.
+func (e PressureThresholdEvent) StallTime() time.Duration {
+	return stallTime(&e.PSILine)
+}
+
+func stallTime(l *procfs.PSILine) time.Duration {
+	return time.Duration(l.Total) * time.Microsecond
+}
+
+// source describes where the pressure of the event was read from.
+// pressure formats the value and threshold the event was evaluated on for
+// messages, e.g. "avg60=30.00 threshold=25.00".
+func (e PressureThresholdEvent) pressure() string {
+	name := e.Window.String()
+	if e.Smoothed != 0 {
+		name += " smoothed"
+	}
+	return fmt.Sprintf("%s=%.2f threshold=%.2f", name, e.Value, e.Threshold)
+}
+
+func (e PressureThresholdEvent) source() string {
+	if e.CgroupName == "" {
+		return e.Resource.String()
+	}
+	return e.CgroupName + "/" + e.Resource.String()
+}
+
+// PressureState tells whether an event reports a transition (exceeded,
+// recovered) or the current state of a resource that did not change.
+type PressureState string
 
+const (
+	PressureExceeded  PressureState = "exceeded"
+	PressureHigh      PressureState = "high"
+	PressureRecovered PressureState = "recovered"
+	PressureNormal    PressureState = "normal"
+	// PressureStuck is reported once a resource stayed high for longer than
+	// Watcher.StuckAfter, e.g. because evictions do not help.
+	PressureStuck PressureState = "stuck"
+	// PressureRising is reported while a resource below the threshold rises
+	// faster than Watcher.RiseRate.
+	PressureRising PressureState = "rising"
+	// PressurePaused is reported for every resource that was high when the
+	// node got disabled, see DisableAnnotation. It counts as normal from then
+	// on.
+	PressurePaused PressureState = "paused"
+)
+
+// IsHigh reports whether the resource is above the threshold.
+func (s PressureState) IsHigh() bool {
+	return s == PressureExceeded || s == PressureHigh || s == PressureStuck
+}
+
+// Watcher polls the pressure of the watched resources. Its methods are safe
+// for concurrent use, e.g. Current from an HTTP handler while Run is active.
+// The exported fields are not guarded and must not be changed once Run was
+// called.
 type Watcher struct {
-	TickerInterval    time.Duration
+	TickerInterval time.Duration
+	// Jitter randomizes every interval between two ticks by up to that
+	// fraction of TickerInterval, e.g. 0.1 for ±10%, so the watchers of
+	// many nodes do not tick in lockstep. Zero disables it.
+	Jitter            float64
 	PressureThreshold float64
+	// LowThreshold is the pressure a resource has to fall below before it is
+	// considered recovered. Zero means PressureThreshold.
+	LowThreshold float64
+	// Thresholds overrides PressureThreshold for single resources, e.g. a
+	// lower threshold for io. LowThreshold is capped at these thresholds.
+	Thresholds map[Resource]float64
+	Resources  []Resource
+	// Window is the running average compared against PressureThreshold,
+	// avg60 by default.
+	Window Window
+	// StallType selects the "some" (default) or "full" pressure line.
+	StallType StallType
+	// SustainedFor is how long the pressure has to stay above the threshold
+	// before a resource is considered high. Shorter spikes are ignored.
+	SustainedFor time.Duration
+	// MinEvictionInterval is the minimum time between two exceedance events,
+	// both while a resource stays high and when it exceeds the threshold again
+	// shortly after recovering, giving evicted pods time to be rescheduled and
+	// the pressure time to respond. It applies to every resource and cgroup
+	// on its own; with Aggregation the combined resources share it.
+	MinEvictionInterval time.Duration
+	// ReadTimeout bounds a single read of a pressure file.
+	ReadTimeout time.Duration
+	// ReadRetries is how often a failed or empty read is retried before the
+	// error is reported. The resource keeps its previous state in that case.
+	ReadRetries int
+	// Warmup is the time after Run was called during which the pressure is
+	// only logged, e.g. to ignore the spike of the node's startup. No events
+	// are sent before it passed.
+	Warmup time.Duration
+	// StuckAfter reports a resource as PressureStuck once it stayed high for
+	// that long without recovering. Zero disables it.
+	StuckAfter time.Duration
+	// Smoothing enables an exponential moving average of the window average
+	// across ticks, which is compared against the thresholds instead. Each
+	// tick the average moves by Smoothing (between 0 and 1) towards the new
+	// value, so lower values smooth more. Zero disables it.
+	Smoothing float64
+	// BaselineDeviations enables adaptive thresholds for nodes that normally
+	// run hot: the watcher learns a rolling baseline of the pressure from the
+	// last BaselineSamples reads that were not high, DefaultBaselineSamples
+	// if zero, and the pressure is high once it exceeds the baseline by
+	// BaselineDeviations standard deviations. The absolute thresholds apply
+	// until a quarter of the samples was learnt. Zero disables it.
+	BaselineDeviations float64
+	BaselineSamples    int
+	// RiseRate enables early warnings: a resource below the threshold whose
+	// window average rises by at least RiseRate percentage points per minute
+	// is reported as PressureRising. Zero disables it.
+	RiseRate float64
+	// Logger receives the log output of the run loop, glog if nil.
+	Logger logr.Logger
+	// CgroupRoot is the cgroup v2 mount point relative cgroup paths are
+	// resolved against, DefaultCgroupRoot if empty.
+	CgroupRoot string
+	// Cgroups are watched in addition to the node-wide pressure, for the
+	// same resources and with the same thresholds.
+	Cgroups []Cgroup
+	// Aggregation combines the node-wide resources into a single state, see
+	// Aggregation. Empty reports every resource on its own.
+	Aggregation Aggregation
+	// Node optionally returns the node the watcher runs on, which is checked
+	// for DisableAnnotation every nodeRefreshInterval.
+	Node NodeAccessor
+
+	proc PSIReader
+	// closer is the reader created by NewWatcherFromConfig, if it needs to be
+	// closed
+	closer io.Closer
+
+	// mu guards the threshold state below
+	mu           sync.Mutex
+	state        map[stateKey]*resourceState
+	lastExceeded time.Time
+	startedAt    time.Time
+	disabled     bool
+	// nodeCheckedAt is when Node was last read
+	nodeCheckedAt time.Time
+	// aggregatedHigh is the combined state of Aggregation
+	aggregatedHigh bool
+	// stop, cancel and done control the loop started by Run, see Shutdown;
+	// exceeded, deceeded and errs are the channels it returned
+	stop     chan struct{}
+	cancel   context.CancelFunc
+	done     chan struct{}
+	exceeded <-chan PressureThresholdEvent
+	deceeded <-chan PressureThresholdEvent
+	errs     <-chan error
+
+	callbacksMu sync.Mutex
+	callbacks   []func(PressureThresholdEvent)
+}
 
-	proc            procfs.FS
+// stateKey identifies a watched resource, either node-wide or of a cgroup.
+type stateKey struct {
+	cgroup   string
+	resource Resource
+}
+
+// resourceState is the threshold state tracked for each watched resource.
+type resourceState struct {
 	isCurrentlyHigh bool
+	// exceededSince is when the pressure crossed the threshold while the
+	// resource was not yet high, zero if it is below the threshold.
+	exceededSince time.Time
+	// lastExceeded is the time of the last exceedance event; the resources
+	// combined by Aggregation share Watcher.lastExceeded instead.
+	lastExceeded time.Time
+	// highSince is when the resource became high, stuck is set once it was
+	// reported as PressureStuck.
+	highSince time.Time
+	stuck     bool
+	// smoothed is the moving average of the window average, see smooth.
+	smoothed    float64
+	hasSmoothed bool
+	// baseline is the pressure learnt for BaselineDeviations.
+	baseline baseline
+	// lastAverage is the window average of the previous read at lastRead.
+	lastAverage float64
+	lastRead    time.Time
 }
 
-func NewWatcher(pressureThreshold float64) (*Watcher, error) {
-	if pressureThreshold == 0 {
-		pressureThreshold = 25
+// NewWatcher creates a watcher with the given threshold, tuned by opts, e.g.
+// NewWatcher(25, WithTickerInterval(5*time.Second)).
+func NewWatcher(pressureThreshold float64, opts ...WatcherOption) (*Watcher, error) {
+	cfg := WatcherConfig{
+		PressureThreshold: pressureThreshold,
 	}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	return NewWatcherFromConfig(cfg)
+}
 
-	fs, err := procfs.NewDefaultFS()
-	if err != nil {
-		return nil, err
+// NewWatcherWithFS creates a watcher reading the pressure from the procfs
+// mounted at path, e.g. the host's /proc mounted into a container.
+func NewWatcherWithFS(path string, pressureThreshold float64, opts ...WatcherOption) (*Watcher, error) {
+	return NewWatcher(pressureThreshold, append([]WatcherOption{WithProcPath(path)}, opts...)...)
+}
+
+// interval returns the time until the next tick, TickerInterval randomized
+// by Jitter.
+func (w *Watcher) interval(rnd *rand.Rand) time.Duration {
+	if w.Jitter <= 0 {
+		return w.TickerInterval
 	}
+	return time.Duration(float64(w.TickerInterval) * (1 + w.Jitter*(2*rnd.Float64()-1)))
+}
 
-	return &Watcher{
-		PressureThreshold: pressureThreshold,
-		TickerInterval:    15 * time.Second,
-		proc:              fs,
-	}, nil
+func (w *Watcher) log() logr.Logger {
+	return loggerOr(w.Logger)
+}
+
+// threshold returns the threshold of resource r.
+func (w *Watcher) threshold(r Resource) float64 {
+	if t, ok := w.Thresholds[r]; ok && t > 0 {
+		return t
+	}
+	return w.PressureThreshold
+}
+
+// window returns the configured Window or DefaultWindow.
+func (w *Watcher) window() Window {
+	if !w.Window.valid() {
+		return DefaultWindow
+	}
+	return w.Window
+}
+
+func (w *Watcher) lowThreshold(r Resource) float64 {
+	high := w.threshold(r)
+	if w.LowThreshold <= 0 || w.LowThreshold > high {
+		return high
+	}
+	return w.LowThreshold
+}
+
+// stateFor returns the state of k, creating it if needed. The caller must
+// hold w.mu.
+func (w *Watcher) stateFor(k stateKey) *resourceState {
+	s, ok := w.state[k]
+	if !ok {
+		s = &resourceState{}
+		w.state[k] = s
+	}
+	return s
 }
@@ -0,0 +1,84 @@
+package pressurecooker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/procfs"
+)
+
+// Window selects which of the kernel's running averages is compared against
+// the pressure threshold. The value is the window length in seconds.
+type Window int
+
+const (
+	Window10  Window = 10
+	Window60  Window = 60
+	Window300 Window = 300
+)
+
+// DefaultWindow is used when no window is configured.
+const DefaultWindow = Window60
+
+func (win Window) String() string {
+	return fmt.Sprintf("avg%d", int(win))
+}
+
+// ParseWindow accepts a window either as seconds ("60") or as the name of
+// the average ("avg60").
+func ParseWindow(s string) (Window, error) {
+	switch strings.TrimPrefix(strings.TrimSpace(s), "avg") {
+	case "10":
+		return Window10, nil
+	case "60":
+		return Window60, nil
+	case "300":
+		return Window300, nil
+	}
+	return 0, fmt.Errorf("unknown pressure window %q, expected one of 10, 60 or 300", s)
+}
+
+func (win Window) valid() bool {
+	return win == Window10 || win == Window60 || win == Window300
+}
+
+func (win Window) average(l *procfs.PSILine) float64 {
+	switch win {
+	case Window10:
+		return l.Avg10
+	case Window300:
+		return l.Avg300
+	}
+	return l.Avg60
+}
+
+// averages returns the average of the window and of all shorter windows.
+// A node is only considered to be still (or no longer) under pressure if
+// these agree.
+func (win Window) averages(l *procfs.PSILine) []float64 {
+	switch win {
+	case Window10:
+		return []float64{l.Avg10}
+	case Window300:
+		return []float64{l.Avg300, l.Avg60, l.Avg10}
+	}
+	return []float64{l.Avg60, l.Avg10}
+}
+
+func allAtLeast(values []float64, threshold float64) bool {
+	for _, v := range values {
+		if v < threshold {
+			return false
+		}
+	}
+	return true
+}
+
+func allBelow(values []float64, threshold float64) bool {
+	for _, v := range values {
+		if v >= threshold {
+			return false
+		}
+	}
+	return true
+}